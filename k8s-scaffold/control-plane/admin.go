@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rl-sandbox/k8s-pkg/store"
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+// sandboxSummary is the admin view of a sandbox Redis record
+type sandboxSummary struct {
+	UUID          string            `json:"uuid"`
+	Host          string            `json:"host"`
+	Port          int               `json:"port"`
+	Status        string            `json:"status"`
+	Image         string            `json:"image,omitempty"`
+	Owner         string            `json:"owner,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	ExperimentID  string            `json:"experiment_id,omitempty"`
+	CreatedAt     string            `json:"created_at,omitempty"`
+	ExpiresAt     string            `json:"expires_at,omitempty"`
+	LastHeartbeat string            `json:"last_heartbeat,omitempty"`
+}
+
+// deploymentSummary is the admin view of a sandbox Deployment
+type deploymentSummary struct {
+	Name          string `json:"name"`
+	Replicas      int32  `json:"replicas"`
+	ReadyReplicas int32  `json:"ready_replicas"`
+	Pool          string `json:"pool,omitempty"`
+	CreatedAt     string `json:"created_at"`
+}
+
+// adminOverviewHandler aggregates Redis records, sandbox Deployments, warm pool
+// sizing and gateway metrics into one document. A failing source is reported in
+// its own section instead of failing the whole response.
+func adminOverviewHandler(config *Config, sandboxes *store.Store, deployments *deploymentCache, pool *warmPool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		c.JSON(http.StatusOK, gin.H{
+			"generated_at": time.Now().UTC().Format(time.RFC3339),
+			"namespace":    config.Namespace,
+			"sandboxes":    overviewSandboxes(ctx, sandboxes),
+			"deployments":  overviewDeployments(deployments),
+			"warm_pool":    overviewPool(ctx, config, pool),
+			"gateway":      overviewGateway(ctx, config),
+		})
+	}
+}
+
+func overviewSandboxes(ctx context.Context, sandboxes *store.Store) gin.H {
+	byStatus := map[string]int{}
+	items := []sandboxSummary{}
+
+	iter := sandboxes.Scan(ctx, "*")
+	for iter.Next(ctx) {
+		r, err := sandboxes.Get(ctx, strings.TrimPrefix(iter.Val(), sandboxes.Prefix()))
+		if err != nil {
+			continue // Expired or deleted since the scan
+		}
+		byStatus[r.Status]++
+		items = append(items, summarizeSandbox(r))
+	}
+
+	section := gin.H{"total": len(items), "by_status": byStatus, "items": items}
+	if err := iter.Err(); err != nil {
+		section["error"] = err.Error()
+	}
+	return section
+}
+
+// summarizeSandbox converts a store record to its admin view
+func summarizeSandbox(r *store.Record) sandboxSummary {
+	return sandboxSummary{
+		UUID:          r.UUID,
+		Host:          r.Host,
+		Port:          r.PortOrDefault(),
+		Status:        r.Status,
+		Image:         r.Image,
+		Owner:         r.Owner,
+		Labels:        r.Labels,
+		ExperimentID:  r.ExperimentID,
+		CreatedAt:     formatOverviewTime(r.CreatedAt),
+		ExpiresAt:     formatOverviewTime(r.ExpiresAt),
+		LastHeartbeat: formatOverviewTime(r.LastHeartbeat),
+	}
+}
+
+func overviewDeployments(deployments *deploymentCache) gin.H {
+	if !deployments.ready() {
+		return gin.H{"error": "deployment status cache not synced yet"}
+	}
+	deps, err := deployments.list()
+	if err != nil {
+		return gin.H{"error": err.Error()}
+	}
+
+	ready := 0
+	items := make([]deploymentSummary, 0, len(deps))
+	for _, dep := range deps {
+		summary := summarizeDeployment(dep)
+		if summary.ReadyReplicas >= summary.Replicas {
+			ready++
+		}
+		items = append(items, summary)
+	}
+	return gin.H{"total": len(items), "ready": ready, "items": items}
+}
+
+// summarizeDeployment converts a sandbox Deployment to its admin view
+func summarizeDeployment(dep *appsv1.Deployment) deploymentSummary {
+	replicas := int32(1)
+	if dep.Spec.Replicas != nil {
+		replicas = *dep.Spec.Replicas
+	}
+	return deploymentSummary{
+		Name:          dep.Name,
+		Replicas:      replicas,
+		ReadyReplicas: dep.Status.ReadyReplicas,
+		Pool:          dep.Labels[poolLabel],
+		CreatedAt:     dep.CreationTimestamp.UTC().Format(time.RFC3339),
+	}
+}
+
+func overviewPool(ctx context.Context, config *Config, pool *warmPool) gin.H {
+	if pool == nil {
+		return gin.H{"enabled": false}
+	}
+	return gin.H{
+		"enabled": true,
+		"image":   config.WarmPoolImage,
+		"min":     config.WarmPoolMin,
+		"max":     config.WarmPoolMax,
+		"desired": pool.desired(ctx),
+	}
+}
+
+// overviewGateway scrapes the gateway's Prometheus metrics into a flat map
+func overviewGateway(ctx context.Context, config *Config) gin.H {
+	if config.GatewayURL == "" {
+		return gin.H{"enabled": false}
+	}
+	url := strings.TrimRight(config.GatewayURL, "/") + "/metrics"
+	section := gin.H{"url": url}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		section["error"] = err.Error()
+		return section
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		section["error"] = err.Error()
+		return section
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		section["error"] = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+		return section
+	}
+
+	metrics := map[string]float64{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		if v, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+			metrics[name] = v
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		section["error"] = err.Error()
+	}
+	section["metrics"] = metrics
+	return section
+}
+
+func formatOverviewTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
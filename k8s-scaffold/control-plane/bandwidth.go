@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Pod annotations honoured by the CNI bandwidth plugin
+const (
+	ingressBandwidthAnnotation = "kubernetes.io/ingress-bandwidth"
+	egressBandwidthAnnotation  = "kubernetes.io/egress-bandwidth"
+)
+
+// BandwidthReq caps a sandbox's network throughput in bits per second
+type BandwidthReq struct {
+	Ingress string `json:"ingress"` // e.g. 100M, empty = unlimited
+	Egress  string `json:"egress"`  // e.g. 10M, empty = unlimited
+}
+
+// addBandwidth annotates the sandbox pods with traffic shaping limits so one
+// sandbox's bulk transfer cannot saturate the node NIC. The limits only take
+// effect on clusters whose CNI chain includes the bandwidth plugin.
+func addBandwidth(req *SpawnReq, dep *appsv1.Deployment) error {
+	if req.Bandwidth == nil {
+		return nil
+	}
+	limits := []struct{ annotation, field, value string }{
+		{ingressBandwidthAnnotation, "ingress", req.Bandwidth.Ingress},
+		{egressBandwidthAnnotation, "egress", req.Bandwidth.Egress},
+	}
+	for _, l := range limits {
+		if l.value == "" {
+			continue
+		}
+		q, err := resource.ParseQuantity(l.value)
+		if err != nil || q.Sign() <= 0 {
+			return fmt.Errorf("invalid %s bandwidth %q, want a positive quantity such as 10M", l.field, l.value)
+		}
+		meta := &dep.Spec.Template.ObjectMeta
+		if meta.Annotations == nil {
+			meta.Annotations = map[string]string{}
+		}
+		meta.Annotations[l.annotation] = q.String()
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+func TestAddBandwidth(t *testing.T) {
+	dep := &appsv1.Deployment{}
+	if err := addBandwidth(&SpawnReq{Bandwidth: &BandwidthReq{Ingress: "100M", Egress: "10M"}}, dep); err != nil {
+		t.Fatalf("addBandwidth: %v", err)
+	}
+	ann := dep.Spec.Template.Annotations
+	if ann[ingressBandwidthAnnotation] != "100M" || ann[egressBandwidthAnnotation] != "10M" {
+		t.Errorf("annotations = %v, want ingress 100M and egress 10M", ann)
+	}
+
+	// A single direction leaves the other unlimited
+	dep = &appsv1.Deployment{}
+	if err := addBandwidth(&SpawnReq{Bandwidth: &BandwidthReq{Egress: "1G"}}, dep); err != nil {
+		t.Fatalf("addBandwidth: %v", err)
+	}
+	if _, ok := dep.Spec.Template.Annotations[ingressBandwidthAnnotation]; ok {
+		t.Error("ingress annotation set for an egress-only limit")
+	}
+
+	for _, req := range []*BandwidthReq{nil, {}} {
+		dep := &appsv1.Deployment{}
+		if err := addBandwidth(&SpawnReq{Bandwidth: req}, dep); err != nil || len(dep.Spec.Template.Annotations) > 0 {
+			t.Errorf("addBandwidth(%+v) = %v with annotations %v, want no limits", req, err, dep.Spec.Template.Annotations)
+		}
+	}
+}
+
+func TestAddBandwidthRejectsInvalidRates(t *testing.T) {
+	for _, rate := range []string{"fast", "0", "-10M"} {
+		if err := addBandwidth(&SpawnReq{Bandwidth: &BandwidthReq{Ingress: rate}}, &appsv1.Deployment{}); err == nil {
+			t.Errorf("ingress rate %q accepted", rate)
+		}
+	}
+}
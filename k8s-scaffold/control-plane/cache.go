@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rl-sandbox/k8s-pkg/ash"
+	"github.com/rl-sandbox/k8s-pkg/store"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// sandboxSelector matches every Deployment the control-plane created for a sandbox
+const sandboxSelector = "from=control-plane,type=sandbox"
+
+// deploymentCache serves sandbox Deployment status from a shared informer, so
+// status polling costs one watch per replica instead of an API call per request
+type deploymentCache struct {
+	factory informers.SharedInformerFactory
+	lister  appslisters.DeploymentLister
+	synced  cache.InformerSynced
+}
+
+func newDeploymentCache(config *Config, clientset *kubernetes.Clientset) *deploymentCache {
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset,
+		time.Duration(config.StatusCacheResyncSec)*time.Second,
+		informers.WithNamespace(config.Namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = sandboxSelector
+		}))
+	deployments := factory.Apps().V1().Deployments()
+	return &deploymentCache{
+		factory: factory,
+		lister:  deployments.Lister(),
+		synced:  deployments.Informer().HasSynced,
+	}
+}
+
+// run starts the informer and blocks until ctx is done
+func (dc *deploymentCache) run(ctx context.Context) {
+	dc.factory.Start(ctx.Done())
+	if cache.WaitForCacheSync(ctx.Done(), dc.synced) {
+		log.Printf("Deployment status cache synced")
+	}
+	<-ctx.Done()
+	dc.factory.Shutdown()
+}
+
+func (dc *deploymentCache) ready() bool {
+	return dc.synced()
+}
+
+// list returns the cached sandbox Deployments
+func (dc *deploymentCache) list() ([]*appsv1.Deployment, error) {
+	return dc.lister.List(labels.Everything())
+}
+
+// get returns the cached Deployment, nil if there is none
+func (dc *deploymentCache) get(namespace, name string) (*appsv1.Deployment, error) {
+	dep, err := dc.lister.Deployments(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	return dep, err
+}
+
+// sandboxStatus is a sandbox Redis record joined with its Deployment status
+type sandboxStatus struct {
+	sandboxSummary
+	Deployment *deploymentSummary `json:"deployment,omitempty"` // Nil if the Deployment is gone
+	Ready      bool               `json:"ready"`
+}
+
+// deploymentRef extracts the Deployment name and namespace from a record's service host
+func deploymentRef(r *store.Record) (namespace, name string) {
+	parts := strings.Split(r.Host, ".")
+	if len(parts) < 2 {
+		return "", ""
+	}
+	return parts[1], parts[0]
+}
+
+func (dc *deploymentCache) status(r *store.Record) sandboxStatus {
+	st := sandboxStatus{sandboxSummary: summarizeSandbox(r)}
+	if dep, err := dc.get(deploymentRef(r)); err == nil && dep != nil {
+		summary := summarizeDeployment(dep)
+		st.Deployment = &summary
+		st.Ready = summary.ReadyReplicas >= summary.Replicas
+	}
+	return st
+}
+
+// listHandler serves GET /sandboxes?status=<status>
+func (dc *deploymentCache) listHandler(sandboxes *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !dc.ready() {
+			respondError(c, http.StatusServiceUnavailable, ash.CodeKubernetesError, "Deployment status cache not synced yet")
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		status := c.Query("status")
+		items := []sandboxStatus{}
+		iter := sandboxes.Scan(ctx, "*")
+		for iter.Next(ctx) {
+			r, err := sandboxes.Get(ctx, strings.TrimPrefix(iter.Val(), sandboxes.Prefix()))
+			if err != nil {
+				continue // Expired or deleted since the scan
+			}
+			if status != "" && r.Status != status {
+				continue
+			}
+			items = append(items, dc.status(r))
+		}
+		if err := iter.Err(); err != nil {
+			respondError(c, http.StatusInternalServerError, ash.CodeRedisError, "Failed to list sandboxes")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"total": len(items), "sandboxes": items})
+	}
+}
+
+// getHandler serves GET /sandbox/:uuid
+func (dc *deploymentCache) getHandler(sandboxes *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !dc.ready() {
+			respondError(c, http.StatusServiceUnavailable, ash.CodeKubernetesError, "Deployment status cache not synced yet")
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		defer cancel()
+
+		r, err := sandboxes.Get(ctx, c.Param("uuid"))
+		if err != nil {
+			respondError(c, http.StatusNotFound, ash.CodeNotFound, "UUID not found")
+			return
+		}
+		c.JSON(http.StatusOK, dc.status(r))
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/rl-sandbox/k8s-pkg/ash"
+	"github.com/rl-sandbox/k8s-pkg/chaos"
+	"github.com/rl-sandbox/k8s-pkg/logging"
+)
+
+// Fault injection for resilience testing. Only mounted when CHAOS_ENABLED is
+// set; rules are managed through /admin/chaos on the admin listener and shared
+// by all replicas via Redis.
+
+const chaosKey = "ash:chaos:control-plane"
+
+// chaosInjector holds the fault rules, refreshed from Redis
+type chaosInjector struct {
+	rdb   *redis.Client
+	rules atomic.Pointer[[]chaos.Rule]
+}
+
+func (ci *chaosInjector) load(ctx context.Context) error {
+	rules, err := chaos.Load(ctx, ci.rdb, chaosKey)
+	if err != nil {
+		return err
+	}
+	ci.rules.Store(&rules)
+	return nil
+}
+
+// run keeps the rules in sync with Redis until ctx is done
+func (ci *chaosInjector) run(ctx context.Context) {
+	ticker := time.NewTicker(chaos.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		if err := ci.load(ctx); err != nil && ctx.Err() == nil {
+			logging.Errorf("Chaos: failed to load rules: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// middleware applies the first matching rule that fires to each request.
+// Probes are exempt so faults cannot get replicas killed.
+func (ci *chaosInjector) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		rules := ci.rules.Load()
+		if rules == nil || path == "/healthz" || path == "/readyz" {
+			c.Next()
+			return
+		}
+		rule := chaos.Pick(*rules, c.Request)
+		if rule == nil {
+			c.Next()
+			return
+		}
+		logger("chaos").Debug("injecting fault", "method", c.Request.Method, "path", path,
+			"latency_ms", rule.LatencyMs, "status", rule.Status, "drop", rule.Drop)
+		if rule.LatencyMs > 0 {
+			select {
+			case <-time.After(time.Duration(rule.LatencyMs) * time.Millisecond):
+			case <-c.Request.Context().Done():
+				c.Abort()
+				return
+			}
+		}
+		if rule.Drop {
+			if conn, _, err := c.Writer.Hijack(); err == nil {
+				conn.Close()
+				c.Abort()
+				return
+			}
+			panic(http.ErrAbortHandler)
+		}
+		if rule.Status != 0 {
+			c.Header(chaos.Header, "true")
+			code := ash.CodeInternal
+			if rule.Status == http.StatusServiceUnavailable || rule.Status == http.StatusGatewayTimeout {
+				code = ash.CodeKubernetesError
+			}
+			c.AbortWithStatusJSON(rule.Status, newAPIError(code, "injected failure"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// getHandler shows the current fault rules
+func (ci *chaosInjector) getHandler(c *gin.Context) {
+	rules := ci.rules.Load()
+	if rules == nil {
+		rules = &[]chaos.Rule{}
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": *rules})
+}
+
+// putHandler replaces the fault rules on every replica
+func (ci *chaosInjector) putHandler(c *gin.Context) {
+	var rules []chaos.Rule
+	if err := c.ShouldBindJSON(&rules); err != nil {
+		respondError(c, http.StatusBadRequest, ash.CodeInvalidRequest, err.Error())
+		return
+	}
+	if err := chaos.Validate(rules); err != nil {
+		respondError(c, http.StatusBadRequest, ash.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	if err := chaos.Store(c.Request.Context(), ci.rdb, chaosKey, rules); err != nil {
+		respondError(c, http.StatusInternalServerError, ash.CodeRedisError, "Failed to store chaos rules")
+		return
+	}
+	ci.rules.Store(&rules)
+	log.Printf("Chaos: %d rules installed", len(rules))
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+// deleteHandler clears the fault rules
+func (ci *chaosInjector) deleteHandler(c *gin.Context) {
+	if err := ci.rdb.Del(c.Request.Context(), chaosKey).Err(); err != nil {
+		respondError(c, http.StatusInternalServerError, ash.CodeRedisError, "Failed to clear chaos rules")
+		return
+	}
+	ci.rules.Store(&[]chaos.Rule{})
+	log.Printf("Chaos: rules cleared")
+	c.JSON(http.StatusOK, gin.H{"message": "Chaos rules cleared"})
+}
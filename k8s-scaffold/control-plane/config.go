@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rl-sandbox/k8s-pkg/settings"
+)
+
+// validate rejects configurations that would misbehave at runtime
+func (c *Config) validate() error {
+	var errs []string
+	if c.Namespace == "" {
+		errs = append(errs, "TARGET_NAMESPACE must not be empty")
+	}
+	if c.RedisPort <= 0 || c.RedisPort > 65535 {
+		errs = append(errs, "REDIS_PORT must be between 1 and 65535")
+	}
+	if c.WaitDeployReadySec < 0 {
+		errs = append(errs, "WAIT_DEPLOY_READY_SEC must not be negative")
+	}
+	if c.WaitSvcIPSec < 0 {
+		errs = append(errs, "WAIT_SVC_IP_SEC must not be negative")
+	}
+	if c.AdminAddr == "" || c.AdminAddr == ":8080" {
+		errs = append(errs, "ADMIN_ADDR must be set and differ from the API port :8080")
+	}
+	if c.HeartbeatIntervalSec > 0 && c.HeartbeatMissed < 1 {
+		errs = append(errs, "HEARTBEAT_MISSED must be >= 1")
+	}
+	if c.WorkspaceExportGraceSec <= 0 {
+		errs = append(errs, "WORKSPACE_EXPORT_GRACE_SEC must be positive")
+	}
+	switch c.ImageScanMode {
+	case scanModeOff:
+	case scanModeWarn, scanModeEnforce:
+		if c.ImageScanServer == "" {
+			errs = append(errs, "IMAGE_SCAN_SERVER is required when IMAGE_SCAN_MODE is set")
+		}
+		if _, err := parseScanThresholds(c.ImageScanThresholds); err != nil {
+			errs = append(errs, "IMAGE_SCAN_THRESHOLDS: "+err.Error())
+		}
+		if c.ImageScanTimeoutSec <= 0 || c.ImageScanCacheSec <= 0 || c.ImageScanTagCacheSec <= 0 {
+			errs = append(errs, "IMAGE_SCAN_TIMEOUT_SEC, IMAGE_SCAN_CACHE_SEC and IMAGE_SCAN_TAG_CACHE_SEC must be positive")
+		}
+	default:
+		errs = append(errs, "IMAGE_SCAN_MODE must be off, warn or enforce")
+	}
+	if c.ImageVerify {
+		if c.ImageVerifyKeys == "" && c.ImageVerifyIdentity == "" {
+			errs = append(errs, "IMAGE_VERIFY requires IMAGE_VERIFY_KEYS or IMAGE_VERIFY_IDENTITY_REGEXP")
+		}
+		if c.ImageVerifyIdentity != "" && c.ImageVerifyIssuer == "" {
+			errs = append(errs, "IMAGE_VERIFY_IDENTITY_REGEXP requires IMAGE_VERIFY_OIDC_ISSUER")
+		}
+		if c.ImageVerifyTimeoutSec <= 0 || c.ImageVerifyCacheSec <= 0 {
+			errs = append(errs, "IMAGE_VERIFY_TIMEOUT_SEC and IMAGE_VERIFY_CACHE_SEC must be positive")
+		}
+	}
+	if c.FleetReconcileSec <= 0 || c.FleetMaxReplicas < 0 {
+		errs = append(errs, "FLEET_RECONCILE_SEC must be positive and FLEET_MAX_REPLICAS not negative")
+	}
+	if c.Sharding {
+		if c.ShardID == "" || c.ShardURL == "" {
+			errs = append(errs, "SHARDING requires SHARD_ID and SHARD_ADVERTISE_URL")
+		}
+		if c.ShardVnodes <= 0 || c.ShardLeaseSec < 3 {
+			errs = append(errs, "SHARD_VNODES must be positive and SHARD_LEASE_SEC >= 3")
+		}
+	}
+	if c.ExecBufferBytes <= 0 || c.ExecCommandTimeoutSec <= 0 || c.ExecIdleSec <= 0 {
+		errs = append(errs, "EXEC_BUFFER_BYTES, EXEC_COMMAND_TIMEOUT_SEC and EXEC_IDLE_SEC must be positive")
+	}
+	if c.StatusCacheResyncSec < 0 {
+		errs = append(errs, "STATUS_CACHE_RESYNC_SEC must not be negative")
+	}
+	if c.WarmPoolImage != "" {
+		if c.WarmPoolMin < 0 || c.WarmPoolMax < c.WarmPoolMin {
+			errs = append(errs, "WARM_POOL_MIN/WARM_POOL_MAX must satisfy 0 <= min <= max")
+		}
+		if c.WarmPoolWindowSec <= 0 || c.WarmPoolReconcileSec <= 0 {
+			errs = append(errs, "WARM_POOL_WINDOW_SEC and WARM_POOL_RECONCILE_SEC must be positive")
+		}
+	}
+	if c.SandboxTTLSec < 0 {
+		errs = append(errs, "SANDBOX_TTL_SEC must not be negative")
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// configzHandler shows the effective configuration with secrets masked
+func configzHandler(config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, settings.Effective(config))
+	}
+}
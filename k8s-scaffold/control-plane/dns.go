@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// DNSReq overrides name resolution in a sandbox
+type DNSReq struct {
+	Nameservers []string          `json:"nameservers"` // Replace cluster DNS with these servers (max 3)
+	Searches    []string          `json:"searches"`    // Extra search domains
+	Options     map[string]string `json:"options"`     // resolv.conf options, e.g. {"ndots": "2"}, empty value for flags
+}
+
+// HostAliasReq maps hostnames to an IP in the sandbox's /etc/hosts
+type HostAliasReq struct {
+	IP        string   `json:"ip"`
+	Hostnames []string `json:"hostnames"`
+}
+
+// addDNS applies custom DNS settings and hostAliases to a sandbox Deployment so
+// sandboxes can reach mock services under production-like hostnames. Custom
+// nameservers replace cluster DNS; search domains and options alone are merged
+// into it.
+func addDNS(req *SpawnReq, dep *appsv1.Deployment) error {
+	spec := &dep.Spec.Template.Spec
+
+	for _, alias := range req.HostAliases {
+		if net.ParseIP(alias.IP) == nil {
+			return fmt.Errorf("invalid host alias IP %q", alias.IP)
+		}
+		if len(alias.Hostnames) == 0 {
+			return fmt.Errorf("host alias %s has no hostnames", alias.IP)
+		}
+		for _, h := range alias.Hostnames {
+			if errs := validation.IsDNS1123Subdomain(h); len(errs) > 0 {
+				return fmt.Errorf("invalid host alias hostname %q: %s", h, strings.Join(errs, "; "))
+			}
+		}
+		spec.HostAliases = append(spec.HostAliases, corev1.HostAlias{IP: alias.IP, Hostnames: alias.Hostnames})
+	}
+
+	if req.DNS == nil {
+		return nil
+	}
+	if len(req.DNS.Nameservers) > 3 {
+		return fmt.Errorf("at most 3 nameservers are allowed")
+	}
+	if len(req.DNS.Searches) > 32 {
+		return fmt.Errorf("at most 32 search domains are allowed")
+	}
+	cfg := &corev1.PodDNSConfig{}
+	for _, ns := range req.DNS.Nameservers {
+		if net.ParseIP(ns) == nil {
+			return fmt.Errorf("invalid nameserver %q", ns)
+		}
+		cfg.Nameservers = append(cfg.Nameservers, ns)
+	}
+	for _, s := range req.DNS.Searches {
+		if errs := validation.IsDNS1123Subdomain(s); len(errs) > 0 {
+			return fmt.Errorf("invalid search domain %q: %s", s, strings.Join(errs, "; "))
+		}
+		cfg.Searches = append(cfg.Searches, s)
+	}
+	names := make([]string, 0, len(req.DNS.Options))
+	for name := range req.DNS.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := req.DNS.Options[name]
+		opt := corev1.PodDNSConfigOption{Name: name}
+		if value != "" {
+			opt.Value = &value
+		}
+		cfg.Options = append(cfg.Options, opt)
+	}
+
+	if len(cfg.Nameservers) > 0 {
+		spec.DNSPolicy = corev1.DNSNone
+	}
+	spec.DNSConfig = cfg
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// dnsSpec applies req's DNS settings to an empty Deployment and returns its pod spec
+func dnsSpec(t *testing.T, req SpawnReq) corev1.PodSpec {
+	t.Helper()
+	dep := &appsv1.Deployment{}
+	if err := addDNS(&req, dep); err != nil {
+		t.Fatalf("addDNS: %v", err)
+	}
+	return dep.Spec.Template.Spec
+}
+
+func TestAddDNS(t *testing.T) {
+	if spec := dnsSpec(t, SpawnReq{}); spec.DNSPolicy != "" || spec.DNSConfig != nil || spec.HostAliases != nil {
+		t.Errorf("spec without DNS settings = %+v, want cluster defaults", spec)
+	}
+
+	// Custom nameservers replace cluster DNS entirely
+	spec := dnsSpec(t, SpawnReq{DNS: &DNSReq{Nameservers: []string{"10.0.0.53"}}})
+	if spec.DNSPolicy != corev1.DNSNone || spec.DNSConfig == nil || spec.DNSConfig.Nameservers[0] != "10.0.0.53" {
+		t.Errorf("nameserver spec = policy %q config %+v, want None with 10.0.0.53", spec.DNSPolicy, spec.DNSConfig)
+	}
+
+	// Search domains and options merge into cluster DNS
+	spec = dnsSpec(t, SpawnReq{DNS: &DNSReq{Searches: []string{"mock.internal"}, Options: map[string]string{"ndots": "2"}}})
+	if spec.DNSPolicy != "" || spec.DNSConfig == nil || len(spec.DNSConfig.Options) != 1 {
+		t.Errorf("search spec = policy %q config %+v, want cluster DNS plus one option", spec.DNSPolicy, spec.DNSConfig)
+	}
+
+	spec = dnsSpec(t, SpawnReq{HostAliases: []HostAliasReq{{IP: "10.1.2.3", Hostnames: []string{"api.example.com"}}}})
+	if len(spec.HostAliases) != 1 || spec.HostAliases[0].IP != "10.1.2.3" {
+		t.Errorf("HostAliases = %+v, want one alias for 10.1.2.3", spec.HostAliases)
+	}
+}
+
+func TestAddDNSRejects(t *testing.T) {
+	invalid := map[string]SpawnReq{
+		"too many nameservers":    {DNS: &DNSReq{Nameservers: []string{"1.1.1.1", "1.0.0.1", "8.8.8.8", "8.8.4.4"}}},
+		"hostname nameserver":     {DNS: &DNSReq{Nameservers: []string{"dns.example.com"}}},
+		"invalid search domain":   {DNS: &DNSReq{Searches: []string{"Not_A_Domain"}}},
+		"invalid alias IP":        {HostAliases: []HostAliasReq{{IP: "nope", Hostnames: []string{"a.example.com"}}}},
+		"alias without hostnames": {HostAliases: []HostAliasReq{{IP: "10.1.2.3"}}},
+	}
+	for name, req := range invalid {
+		if err := addDNS(&req, &appsv1.Deployment{}); err == nil {
+			t.Errorf("%s: addDNS accepted %+v", name, req)
+		}
+	}
+}
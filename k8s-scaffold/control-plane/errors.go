@@ -0,0 +1,16 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/rl-sandbox/k8s-pkg/ash"
+)
+
+// newAPIError builds a control-plane error, deriving the retryable flag from the code
+func newAPIError(code, message string) *ash.Error {
+	return ash.NewError("control-plane", code, message)
+}
+
+// respondError writes a structured JSON error response
+func respondError(c *gin.Context, status int, code, message string) {
+	c.JSON(status, newAPIError(code, message))
+}
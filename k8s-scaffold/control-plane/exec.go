@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rl-sandbox/k8s-pkg/ash"
+	"github.com/rl-sandbox/k8s-pkg/logging"
+	"github.com/rl-sandbox/k8s-pkg/store"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// The exec driver gives the Kubernetes backend the hostagent's run_command and
+// get_output semantics: each sandbox gets one persistent TTY shell whose output
+// is buffered here, and commands are delimited by markers echoed after them.
+
+// RunCommandReq runs a command in a sandbox's persistent shell
+type RunCommandReq struct {
+	Command     string `json:"command"`
+	TimeoutSec  int    `json:"timeout_sec"` // Max wait for a non-interactive command, default EXEC_COMMAND_TIMEOUT_SEC
+	Interactive bool   `json:"interactive"` // Write Command as raw input (e.g. "\u0003" for ^C) instead of waiting for it to finish
+	WaitMs      int    `json:"wait_ms"`     // How long to collect output after interactive input, default 1000
+}
+
+// RunCommandResp is the result of a run_command call
+type RunCommandResp struct {
+	UUID     string `json:"uuid"`
+	Output   string `json:"output"`
+	ExitCode *int   `json:"exit_code,omitempty"` // Unset for interactive input and timeouts
+	TimedOut bool   `json:"timed_out"`
+	Offset   int64  `json:"offset"` // Buffer offset after this output, pass as since to get_output
+}
+
+var shellMarkerRe = regexp.MustCompile(`__ASH_DONE_([0-9]+)_([0-9]+)__\n?`)
+
+// shellSession is a persistent TTY shell attached to a sandbox pod
+type shellSession struct {
+	pod    string
+	stdin  *io.PipeWriter
+	cancel context.CancelFunc
+
+	cmdMu sync.Mutex // One command at a time
+
+	mu       sync.Mutex
+	buf      []byte
+	base     int64         // Offset of buf[0] in the whole output stream
+	notify   chan struct{} // Closed and replaced on every write
+	err      error         // Set once the stream ended
+	lastUsed time.Time
+	seq      int
+	maxBytes int
+}
+
+// Write appends shell output, normalising TTY line endings and trimming the oldest bytes past maxBytes
+func (s *shellSession) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf = append(s.buf, bytes.ReplaceAll(p, []byte("\r\n"), []byte("\n"))...)
+	if over := len(s.buf) - s.maxBytes; over > 0 {
+		s.buf = append([]byte(nil), s.buf[over:]...)
+		s.base += int64(over)
+	}
+	close(s.notify)
+	s.notify = make(chan struct{})
+	return len(p), nil
+}
+
+// since returns the buffered output from offset on and the current end offset.
+// It also returns the channel the next write will close and the stream error,
+// read under the same lock so a write right after the read is never missed.
+func (s *shellSession) since(offset int64) ([]byte, int64, <-chan struct{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	end := s.base + int64(len(s.buf))
+	if offset < s.base {
+		offset = s.base
+	}
+	if offset > end {
+		offset = end
+	}
+	return append([]byte(nil), s.buf[offset-s.base:]...), end, s.notify, s.err
+}
+
+// waitMarker collects output from start until the marker of command seq appears,
+// returning its exit code, the output before it and the offset after it. On
+// error the output so far is returned. Output trimmed from the buffer before
+// it was read is lost, so the output may begin after start.
+func (s *shellSession) waitMarker(ctx context.Context, start int64, seq int) (int, string, int64, error) {
+	for {
+		out, end, notify, err := s.since(start)
+		for _, loc := range shellMarkerRe.FindAllSubmatchIndex(out, -1) {
+			if string(out[loc[2]:loc[3]]) != strconv.Itoa(seq) {
+				continue
+			}
+			code, _ := strconv.Atoi(string(out[loc[4]:loc[5]]))
+			return code, strings.TrimSuffix(string(out[:loc[0]]), "\n"), end - int64(len(out)) + int64(loc[1]), nil
+		}
+		if err != nil {
+			return 0, string(out), end, err
+		}
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return 0, string(out), end, ctx.Err()
+		}
+	}
+}
+
+func (s *shellSession) closed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err != nil
+}
+
+func (s *shellSession) close() {
+	s.cancel()
+	s.stdin.Close()
+}
+
+// shellManager owns the shell sessions of the sandboxes served by this instance
+type shellManager struct {
+	config     *Config
+	clientset  *kubernetes.Clientset
+	restConfig *rest.Config
+	sandboxes  *store.Store
+
+	mu        sync.Mutex
+	sessions  map[string]*shellSession
+	attaching map[string]*attachLock // Serialises shell creation per sandbox
+}
+
+// attachLock lets one caller attach a sandbox's shell while the others wait for it
+type attachLock struct {
+	mu      sync.Mutex
+	waiters int // Callers holding or waiting for mu, guarded by shellManager.mu
+}
+
+func newShellManager(config *Config, clientset *kubernetes.Clientset, restConfig *rest.Config, sandboxes *store.Store) *shellManager {
+	return &shellManager{
+		config:     config,
+		clientset:  clientset,
+		restConfig: restConfig,
+		sandboxes:  sandboxes,
+		sessions:   map[string]*shellSession{},
+		attaching:  map[string]*attachLock{},
+	}
+}
+
+// sandboxPod finds a running pod of the sandbox behind uuid
+func (m *shellManager) sandboxPod(ctx context.Context, uuid string) (string, string, error) {
+	r, err := m.sandboxes.Get(ctx, uuid)
+	if err != nil {
+		return "", "", err
+	}
+	parts := strings.Split(r.Host, ".")
+	if len(parts) < 2 {
+		return "", "", fmt.Errorf("invalid host format for %s", uuid)
+	}
+	name, namespace := parts[0], parts[1]
+	pods, err := m.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: "app=" + name})
+	if err != nil {
+		return "", "", err
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp == nil {
+			return namespace, pod.Name, nil
+		}
+	}
+	return "", "", errNoRunningPod
+}
+
+var errNoRunningPod = errors.New("sandbox has no running pod")
+
+// live returns the open shell of uuid, or nil
+func (m *shellManager) live(uuid string) *shellSession {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s := m.sessions[uuid]; s != nil && !s.closed() {
+		return s
+	}
+	return nil
+}
+
+// session returns the live shell of uuid, attaching a new one if needed.
+// Concurrent first calls for the same sandbox share a single attach.
+func (m *shellManager) session(ctx context.Context, uuid string) (*shellSession, error) {
+	if s := m.live(uuid); s != nil {
+		return s, nil
+	}
+
+	m.mu.Lock()
+	lock := m.attaching[uuid]
+	if lock == nil {
+		lock = &attachLock{}
+		m.attaching[uuid] = lock
+	}
+	lock.waiters++
+	m.mu.Unlock()
+
+	lock.mu.Lock()
+	defer func() {
+		lock.mu.Unlock()
+		m.mu.Lock()
+		if lock.waiters--; lock.waiters == 0 {
+			delete(m.attaching, uuid)
+		}
+		m.mu.Unlock()
+	}()
+
+	// Another caller may have attached while we waited
+	if s := m.live(uuid); s != nil {
+		return s, nil
+	}
+	s, err := m.attach(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	if old := m.sessions[uuid]; old != nil {
+		old.close() // Already ended, see the check above; release its stream
+	}
+	m.sessions[uuid] = s
+	m.mu.Unlock()
+	log.Printf("Attached shell to sandbox %s (pod %s)", uuid, s.pod)
+	return s, nil
+}
+
+// attach starts a new TTY shell in a running pod of uuid and waits until it is ready
+func (m *shellManager) attach(ctx context.Context, uuid string) (*shellSession, error) {
+	namespace, pod, err := m.sandboxPod(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	req := m.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").Namespace(namespace).Name(pod).SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: "sandbox",
+			Command:   []string{"env", "PS1=", "PS2=", "TERM=dumb", "/bin/sh", "-i"},
+			Stdin:     true,
+			Stdout:    true,
+			TTY:       true,
+		}, scheme.ParameterCodec)
+	executor, err := remotecommand.NewSPDYExecutor(m.restConfig, http.MethodPost, req.URL())
+	if err != nil {
+		return nil, err
+	}
+
+	stdinR, stdinW := io.Pipe()
+	streamCtx, cancel := context.WithCancel(context.Background())
+	s := &shellSession{
+		pod:      pod,
+		stdin:    stdinW,
+		cancel:   cancel,
+		notify:   make(chan struct{}),
+		lastUsed: time.Now(),
+		maxBytes: m.config.ExecBufferBytes,
+	}
+	go func() {
+		err := executor.StreamWithContext(streamCtx, remotecommand.StreamOptions{Stdin: stdinR, Stdout: s, Tty: true})
+		if err == nil {
+			err = io.EOF
+		}
+		stdinR.CloseWithError(err)
+		s.mu.Lock()
+		s.err = err
+		close(s.notify)
+		s.notify = make(chan struct{})
+		s.mu.Unlock()
+		log.Printf("Shell for sandbox %s (pod %s) ended: %v", uuid, pod, err)
+	}()
+
+	// Keep command input out of the output and wait until the shell is ready.
+	// The marker is built by printf so its echo cannot match.
+	if _, err := io.WriteString(stdinW, "stty -echo 2>/dev/null; printf '\\n__ASH_DONE_%s_0__\\n' 0\n"); err != nil {
+		s.close()
+		return nil, err
+	}
+	readyCtx, readyCancel := context.WithTimeout(ctx, 30*time.Second)
+	_, _, _, err = s.waitMarker(readyCtx, 0, 0)
+	readyCancel()
+	if err != nil {
+		s.close()
+		return nil, fmt.Errorf("shell did not start: %w", err)
+	}
+	return s, nil
+}
+
+// run writes a command to the shell. Non-interactive commands are followed by a
+// marker carrying the exit code, and output is collected until it appears.
+func (m *shellManager) run(ctx context.Context, uuid string, req *RunCommandReq) (*RunCommandResp, error) {
+	s, err := m.session(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	s.cmdMu.Lock()
+	defer s.cmdMu.Unlock()
+
+	s.mu.Lock()
+	s.lastUsed = time.Now()
+	s.seq++
+	seq := s.seq
+	start := s.base + int64(len(s.buf))
+	s.mu.Unlock()
+
+	resp := &RunCommandResp{UUID: uuid}
+	if req.Interactive {
+		if _, err := io.WriteString(s.stdin, req.Command); err != nil {
+			return nil, err
+		}
+		wait := time.Duration(req.WaitMs) * time.Millisecond
+		if req.WaitMs <= 0 {
+			wait = time.Second
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+		}
+		out, end, _, _ := s.since(start)
+		resp.Output, resp.Offset = string(out), end
+		return resp, nil
+	}
+
+	timeout := time.Duration(req.TimeoutSec) * time.Second
+	if req.TimeoutSec <= 0 {
+		timeout = time.Duration(m.config.ExecCommandTimeoutSec) * time.Second
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	line := fmt.Sprintf("%s\nprintf '\\n__ASH_DONE_%d_%%s__\\n' \"$?\"\n", strings.TrimRight(req.Command, "\n"), seq)
+	if _, err := io.WriteString(s.stdin, line); err != nil {
+		return nil, err
+	}
+	code, out, end, err := s.waitMarker(waitCtx, start, seq)
+	switch {
+	case err == nil:
+		resp.Output, resp.ExitCode, resp.Offset = out, &code, end
+		return resp, nil
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled):
+		resp.Output, resp.Offset, resp.TimedOut = out, end, true
+		return resp, nil
+	default:
+		return nil, err
+	}
+}
+
+// output returns what the shell of uuid printed since offset
+func (m *shellManager) output(uuid string, offset int64) (*RunCommandResp, bool) {
+	m.mu.Lock()
+	s := m.sessions[uuid]
+	m.mu.Unlock()
+	if s == nil {
+		return nil, false
+	}
+	out, end, _, _ := s.since(offset)
+	return &RunCommandResp{UUID: uuid, Output: string(out), Offset: end}, true
+}
+
+// closeSession detaches the shell of uuid, reporting whether one existed.
+// A nil manager (shells disabled) has none.
+func (m *shellManager) closeSession(uuid string) bool {
+	if m == nil {
+		return false
+	}
+	m.mu.Lock()
+	s := m.sessions[uuid]
+	delete(m.sessions, uuid)
+	m.mu.Unlock()
+	if s != nil {
+		s.close()
+	}
+	return s != nil
+}
+
+// reap closes shells idle for longer than EXEC_IDLE_SEC until ctx is done
+func (m *shellManager) reap(ctx context.Context) {
+	idle := time.Duration(m.config.ExecIdleSec) * time.Second
+	ticker := time.NewTicker(idle / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		m.mu.Lock()
+		for uuid, s := range m.sessions {
+			s.mu.Lock()
+			expired := s.err != nil || time.Since(s.lastUsed) > idle
+			s.mu.Unlock()
+			if expired {
+				s.close()
+				delete(m.sessions, uuid)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+// runCommandHandler serves POST /sandbox/:uuid/run_command
+func (m *shellManager) runCommandHandler(c *gin.Context) {
+	uuid := c.Param("uuid")
+	var req RunCommandReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, ash.CodeInvalidRequest, err.Error())
+		return
+	}
+	if req.Command == "" {
+		respondError(c, http.StatusBadRequest, ash.CodeInvalidRequest, "command is required")
+		return
+	}
+
+	resp, err := m.run(c.Request.Context(), uuid, &req)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		respondError(c, http.StatusNotFound, ash.CodeNotFound, "UUID not found")
+	case errors.Is(err, errNoRunningPod):
+		respondError(c, http.StatusConflict, ash.CodeSandboxNotReady, err.Error())
+	case err != nil:
+		logging.Errorf("run_command failed for %s: %v", uuid, err)
+		respondError(c, http.StatusBadGateway, ash.CodeKubernetesError, fmt.Sprintf("Shell error: %v", err))
+	default:
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// outputHandler serves GET /sandbox/:uuid/output?since=<offset>
+func (m *shellManager) outputHandler(c *gin.Context) {
+	uuid := c.Param("uuid")
+	since, _ := strconv.ParseInt(c.Query("since"), 10, 64)
+	resp, ok := m.output(uuid, since)
+	if !ok {
+		respondError(c, http.StatusNotFound, ash.CodeNotFound, "no shell attached to sandbox")
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// closeShellHandler serves DELETE /sandbox/:uuid/shell
+func (m *shellManager) closeShellHandler(c *gin.Context) {
+	uuid := c.Param("uuid")
+	if !m.closeSession(uuid) {
+		respondError(c, http.StatusNotFound, ash.CodeNotFound, "no shell attached to sandbox")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Shell closed", "uuid": uuid})
+}
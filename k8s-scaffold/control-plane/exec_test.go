@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestShell(maxBytes int) *shellSession {
+	return &shellSession{notify: make(chan struct{}), maxBytes: maxBytes}
+}
+
+func TestShellWaitMarker(t *testing.T) {
+	// Raw shell output mapped to the exit code and output of command 1
+	cases := map[string]struct {
+		code int
+		out  string
+	}{
+		"hello\r\n\n__ASH_DONE_1_0__\r\n":                   {0, "hello\n"},
+		"hello\n__ASH_DONE_1_0__\n":                         {0, "hello"},
+		"ls: missing: No such file\n\n__ASH_DONE_1_2__\n":   {2, "ls: missing: No such file\n"},
+		"\n__ASH_DONE_1_0__\n":                              {0, ""},
+		"\n__ASH_DONE_11_1__\nsecond\n\n__ASH_DONE_1_7__\n": {7, "\n__ASH_DONE_11_1__\nsecond\n"},
+		"done\n__ASH_DONE_1_0__":                            {0, "done"},
+	}
+	for output, want := range cases {
+		s := newTestShell(1 << 20)
+		_, _ = s.Write([]byte(output))
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		code, out, end, err := s.waitMarker(ctx, 0, 1)
+		cancel()
+		if err != nil {
+			t.Fatalf("waitMarker(%q): %v", output, err)
+		}
+		if code != want.code || out != want.out {
+			t.Errorf("waitMarker(%q) = %d, %q, want %d, %q", output, code, out, want.code, want.out)
+		}
+		if _, total, _, _ := s.since(0); end != total {
+			t.Errorf("waitMarker(%q) offset = %d, want end of output %d", output, end, total)
+		}
+	}
+}
+
+func TestShellWaitMarkerWaitsForOutput(t *testing.T) {
+	s := newTestShell(1 << 20)
+	go func() {
+		_, _ = s.Write([]byte("working\n"))
+		time.Sleep(10 * time.Millisecond)
+		_, _ = s.Write([]byte("\n__ASH_DONE_1_0__\n"))
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, out, _, err := s.waitMarker(ctx, 0, 1); err != nil || out != "working\n" {
+		t.Fatalf("waitMarker = %q, %v, want %q", out, err, "working\n")
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, _, err := s.waitMarker(ctx, 0, 2); err != context.DeadlineExceeded {
+		t.Fatalf("waitMarker for a missing marker = %v, want deadline exceeded", err)
+	}
+}
+
+func TestShellBufferTrim(t *testing.T) {
+	s := newTestShell(8)
+	_, _ = s.Write([]byte("0123456789"))
+	out, end, _, _ := s.since(0)
+	if string(out) != "23456789" || end != 10 {
+		t.Fatalf("since(0) = %q, %d, want %q, 10", out, end, "23456789")
+	}
+	if out, _, _, _ := s.since(7); string(out) != "789" {
+		t.Errorf("since(7) = %q, want %q", out, "789")
+	}
+	if out, end, _, _ := s.since(42); len(out) != 0 || end != 10 {
+		t.Errorf("since(42) = %q, %d, want empty, 10", out, end)
+	}
+}
+
+// A command printing more than the buffer holds must still report the offset
+// after its marker, not one relative to the trimmed start
+func TestShellWaitMarkerAfterTrim(t *testing.T) {
+	s := newTestShell(32)
+	_, _ = s.Write([]byte(strings.Repeat("x", 40) + "\n__ASH_DONE_1_0__\n"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, out, offset, err := s.waitMarker(ctx, 0, 1)
+	if err != nil {
+		t.Fatalf("waitMarker: %v", err)
+	}
+	if want := int64(58); offset != want {
+		t.Errorf("offset = %d, want %d", offset, want)
+	}
+	if out != strings.Repeat("x", 14) {
+		t.Errorf("output = %q, want the 14 bytes left in the buffer", out)
+	}
+	if rest, _, _, _ := s.since(offset); len(rest) != 0 {
+		t.Errorf("since(offset) = %q, want nothing repeated", rest)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rl-sandbox/k8s-pkg/ash"
+	"github.com/rl-sandbox/k8s-pkg/logging"
+	"github.com/rl-sandbox/k8s-pkg/store"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+// experimentLabel carries a sandbox's experiment ID on its Kubernetes resources
+const experimentLabel = "experiment"
+
+// experimentSelector selects the sandbox resources of one experiment
+func experimentSelector(id string) string {
+	return fmt.Sprintf("from=control-plane,type=sandbox,%s=%s", experimentLabel, id)
+}
+
+// experimentParam reads and validates the :id path parameter, writing an error if invalid
+func experimentParam(c *gin.Context) (string, bool) {
+	id := c.Param("id")
+	if errs := validation.IsValidLabelValue(id); id == "" || len(errs) > 0 {
+		respondError(c, http.StatusBadRequest, ash.CodeInvalidRequest, "invalid experiment ID")
+		return "", false
+	}
+	return id, true
+}
+
+// experimentListHandler lists the sandboxes of an experiment
+func experimentListHandler(sandboxes *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := experimentParam(c)
+		if !ok {
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		records, err := sandboxes.Experiment(ctx, id)
+		if err != nil {
+			logging.Errorf("Failed to load experiment %s: %v", id, err)
+			respondError(c, http.StatusInternalServerError, ash.CodeRedisError, "Failed to load experiment")
+			return
+		}
+		items := make([]sandboxSummary, 0, len(records))
+		for _, r := range records {
+			items = append(items, summarizeSandbox(r))
+		}
+		c.JSON(http.StatusOK, gin.H{"experiment_id": id, "count": len(items), "sandboxes": items})
+	}
+}
+
+// experimentDeprovisionHandler deletes every sandbox of an experiment
+func experimentDeprovisionHandler(config *Config, sandboxes *store.Store, clientset *kubernetes.Clientset) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := experimentParam(c)
+		if !ok {
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Minute)
+		defer cancel()
+
+		deps, err := clientset.AppsV1().Deployments(config.Namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: experimentSelector(id),
+		})
+		if err != nil {
+			logging.Errorf("Failed to list deployments for experiment %s: %v", id, err)
+			respondError(c, http.StatusInternalServerError, ash.CodeKubernetesError, "Failed to list deployments")
+			return
+		}
+
+		var deleted, failed []string
+		for _, dep := range deps.Items {
+			if err := clientset.CoreV1().Services(dep.Namespace).Delete(ctx, dep.Name, metav1.DeleteOptions{}); err != nil {
+				logging.Errorf("Failed to delete service %s/%s: %v", dep.Namespace, dep.Name, err)
+			}
+			deleteSandboxLinks(ctx, clientset, dep.Namespace, dep.Name)
+			if err := clientset.AppsV1().Deployments(dep.Namespace).Delete(ctx, dep.Name, metav1.DeleteOptions{}); err != nil {
+				logging.Errorf("Failed to delete deployment %s/%s: %v", dep.Namespace, dep.Name, err)
+				failed = append(failed, dep.Name)
+				continue
+			}
+			deleted = append(deleted, dep.Name)
+		}
+
+		records, err := sandboxes.Experiment(ctx, id)
+		if err != nil {
+			logging.Errorf("Failed to load experiment %s records: %v", id, err)
+		}
+		for _, r := range records {
+			if err := sandboxes.Delete(ctx, r.UUID); err != nil {
+				logging.Errorf("Failed to delete Redis key %s: %v", sandboxes.Key(r.UUID), err)
+			}
+		}
+
+		log.Printf("Deprovisioned experiment %s: deleted=%d failed=%d", id, len(deleted), len(failed))
+		c.JSON(http.StatusOK, gin.H{
+			"experiment_id": id,
+			"deleted":       deleted,
+			"failed":        failed,
+			"count":         len(deleted),
+		})
+	}
+}
+
+// experimentUsageHandler aggregates sandbox counts, lifetime and requested resources
+func experimentUsageHandler(config *Config, sandboxes *store.Store, clientset *kubernetes.Clientset) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := experimentParam(c)
+		if !ok {
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		records, err := sandboxes.Experiment(ctx, id)
+		if err != nil {
+			logging.Errorf("Failed to load experiment %s: %v", id, err)
+			respondError(c, http.StatusInternalServerError, ash.CodeRedisError, "Failed to load experiment")
+			return
+		}
+		byStatus := map[string]int{}
+		var sandboxSeconds float64
+		for _, r := range records {
+			byStatus[r.Status]++
+			if !r.CreatedAt.IsZero() {
+				sandboxSeconds += time.Since(r.CreatedAt).Seconds()
+			}
+		}
+
+		deps, err := clientset.AppsV1().Deployments(config.Namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: experimentSelector(id),
+		})
+		if err != nil {
+			logging.Errorf("Failed to list deployments for experiment %s: %v", id, err)
+			respondError(c, http.StatusInternalServerError, ash.CodeKubernetesError, "Failed to list deployments")
+			return
+		}
+		var cpuReq, memReq, cpuLim, memLim resource.Quantity
+		for _, dep := range deps.Items {
+			for _, ctr := range dep.Spec.Template.Spec.Containers {
+				cpuReq.Add(*ctr.Resources.Requests.Cpu())
+				memReq.Add(*ctr.Resources.Requests.Memory())
+				cpuLim.Add(*ctr.Resources.Limits.Cpu())
+				memLim.Add(*ctr.Resources.Limits.Memory())
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"experiment_id":   id,
+			"sandboxes":       len(records),
+			"deployments":     len(deps.Items),
+			"by_status":       byStatus,
+			"sandbox_seconds": int64(sandboxSeconds),
+			"requests":        gin.H{"cpu": cpuReq.String(), "memory": memReq.String()},
+			"limits":          gin.H{"cpu": cpuLim.String(), "memory": memLim.String()},
+		})
+	}
+}
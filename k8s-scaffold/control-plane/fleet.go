@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/rl-sandbox/k8s-pkg/ash"
+	"github.com/rl-sandbox/k8s-pkg/logging"
+	"github.com/rl-sandbox/k8s-pkg/store"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	fleetSpecsKey    = "ash:fleets"
+	fleetLockKey     = "ash:lock:fleet-reconcile"
+	fleetLockTTL     = 10 * time.Minute
+	fleetLabel       = "fleet"
+	fleetRevLabel    = "fleet-rev"
+	fleetSpawnsPerGo = 5
+)
+
+// FleetSpec declares how many sandboxes of a template to keep alive
+type FleetSpec struct {
+	Name     string   `json:"name" binding:"required"`
+	Replicas int      `json:"replicas"`
+	Template SpawnReq `json:"template"`
+}
+
+// revision identifies the template so changed specs roll their sandboxes
+func (f *FleetSpec) revision() string {
+	data, _ := json.Marshal(f.Template)
+	h := fnv.New32a()
+	h.Write(data)
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// releaseLockScript deletes a lock only while it still holds the caller's token,
+// so a round that outlived fleetLockTTL cannot release another replica's lock
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func fleetSelector(name string) string {
+	return fmt.Sprintf("from=control-plane,type=sandbox,%s=%s", fleetLabel, name)
+}
+
+// fleetReconciler continuously enforces the applied fleet specs
+type fleetReconciler struct {
+	config    *Config
+	rdb       *redis.Client
+	clientset *kubernetes.Clientset
+	sandboxes *store.Store
+	spawner   *spawner
+	shards    *shardRing
+}
+
+// specs loads all applied fleet specs
+func (f *fleetReconciler) specs(ctx context.Context) ([]FleetSpec, error) {
+	raw, err := f.rdb.HGetAll(ctx, fleetSpecsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	specs := make([]FleetSpec, 0, len(raw))
+	for name, data := range raw {
+		var spec FleetSpec
+		if err := json.Unmarshal([]byte(data), &spec); err != nil {
+			logging.Warnf("Fleet: skipping unreadable spec %s: %v", name, err)
+			continue
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// run reconciles all fleets every FLEET_RECONCILE_SEC until ctx is done.
+// Rounds may outlast the interval while sandboxes start, so the lock is held
+// for the whole round and released afterwards. With sharding each instance
+// reconciles the fleets it owns and no lock is taken.
+func (f *fleetReconciler) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(f.config.FleetReconcileSec) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		locked, token := false, uuid.NewString()
+		if f.shards == nil {
+			ok, err := f.rdb.SetNX(ctx, fleetLockKey, token, fleetLockTTL).Result()
+			locked = err == nil && ok
+		}
+		if f.shards != nil || locked {
+			specs, err := f.specs(ctx)
+			if err != nil {
+				logging.Errorf("Fleet: failed to load specs: %v", err)
+			}
+			for i := range specs {
+				if f.shards.owns(fleetLabel + ":" + specs[i].Name) {
+					f.reconcile(ctx, &specs[i])
+				}
+			}
+		}
+		if locked {
+			if err := releaseLockScript.Run(context.Background(), f.rdb, []string{fleetLockKey}, token).Err(); err != nil {
+				logging.Errorf("Fleet: failed to release reconcile lock: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcile spawns missing sandboxes and removes surplus or outdated ones.
+// Sandboxes from an older template revision are removed once enough current
+// ones are ready.
+func (f *fleetReconciler) reconcile(ctx context.Context, spec *FleetSpec) {
+	deps, err := f.clientset.AppsV1().Deployments(f.config.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fleetSelector(spec.Name),
+	})
+	if err != nil {
+		logging.Errorf("Fleet %s: failed to list sandboxes: %v", spec.Name, err)
+		return
+	}
+
+	rev := spec.revision()
+	var current, stale []*appsv1.Deployment
+	ready := 0
+	for i := range deps.Items {
+		dep := &deps.Items[i]
+		if dep.Labels[fleetRevLabel] != rev {
+			stale = append(stale, dep)
+			continue
+		}
+		current = append(current, dep)
+		if dep.Status.AvailableReplicas >= 1 {
+			ready++
+		}
+	}
+
+	if missing := spec.Replicas - len(current); missing > 0 {
+		log.Printf("Fleet %s: spawning %d (have %d, want %d)", spec.Name, min(missing, fleetSpawnsPerGo), len(current), spec.Replicas)
+		f.spawnN(ctx, spec, rev, min(missing, fleetSpawnsPerGo))
+	}
+	if surplus := len(current) - spec.Replicas; surplus > 0 {
+		// Remove sandboxes that are not ready yet first, they are the least useful
+		for _, wantReady := range []bool{false, true} {
+			for _, dep := range current {
+				if surplus == 0 {
+					break
+				}
+				if (dep.Status.AvailableReplicas >= 1) != wantReady {
+					continue
+				}
+				f.remove(ctx, dep)
+				surplus--
+			}
+		}
+	}
+	if len(stale) > 0 && ready >= spec.Replicas {
+		for _, dep := range stale {
+			f.remove(ctx, dep)
+		}
+	}
+}
+
+// spawnN creates n sandboxes from the fleet template concurrently
+func (f *fleetReconciler) spawnN(ctx context.Context, spec *FleetSpec, rev string, n int) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			req := spec.Template
+			req.Name = ""
+			req.Labels = map[string]string{}
+			for k, v := range spec.Template.Labels {
+				req.Labels[k] = v
+			}
+			req.Labels[fleetLabel] = spec.Name
+			req.Labels[fleetRevLabel] = rev
+
+			spawnCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+			defer cancel()
+			if _, _, apiErr := f.spawner.spawn(spawnCtx, req); apiErr != nil {
+				logging.Errorf("Fleet %s: spawn failed: %v", spec.Name, apiErr)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (f *fleetReconciler) remove(ctx context.Context, dep *appsv1.Deployment) {
+	if err := teardownSandbox(ctx, f.clientset, f.sandboxes, dep.Namespace, dep.Name); err != nil {
+		logging.Errorf("Fleet: failed to remove sandbox %s: %v", dep.Name, err)
+	}
+}
+
+// applyHandler stores a fleet spec for the reconciler to enforce
+func (f *fleetReconciler) applyHandler(c *gin.Context) {
+	var spec FleetSpec
+	if err := c.ShouldBindJSON(&spec); err != nil {
+		respondError(c, http.StatusBadRequest, ash.CodeInvalidRequest, err.Error())
+		return
+	}
+	if errs := validation.IsValidLabelValue(spec.Name); len(errs) > 0 {
+		respondError(c, http.StatusBadRequest, ash.CodeInvalidRequest, "invalid fleet name")
+		return
+	}
+	if spec.Replicas < 0 || spec.Replicas > f.config.FleetMaxReplicas {
+		respondError(c, http.StatusBadRequest, ash.CodeInvalidRequest, fmt.Sprintf("replicas must be between 0 and %d", f.config.FleetMaxReplicas))
+		return
+	}
+	if spec.Template.Name != "" {
+		respondError(c, http.StatusBadRequest, ash.CodeInvalidRequest, "template.name is not allowed, fleet sandboxes are named automatically")
+		return
+	}
+
+	data, _ := json.Marshal(spec)
+	if err := f.rdb.HSet(c.Request.Context(), fleetSpecsKey, spec.Name, data).Err(); err != nil {
+		logging.Errorf("Failed to store fleet spec %s: %v", spec.Name, err)
+		respondError(c, http.StatusInternalServerError, ash.CodeRedisError, "Failed to store fleet spec")
+		return
+	}
+	log.Printf("Applied fleet %s: replicas=%d image=%s", spec.Name, spec.Replicas, spec.Template.Image)
+	c.JSON(http.StatusOK, gin.H{"name": spec.Name, "replicas": spec.Replicas, "revision": spec.revision()})
+}
+
+// listHandler reports each fleet's desired and observed size
+func (f *fleetReconciler) listHandler(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	specs, err := f.specs(ctx)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, ash.CodeRedisError, "Failed to load fleet specs")
+		return
+	}
+	fleets := make([]gin.H, 0, len(specs))
+	for i := range specs {
+		spec := &specs[i]
+		deps, err := f.clientset.AppsV1().Deployments(f.config.Namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: fleetSelector(spec.Name),
+		})
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, ash.CodeKubernetesError, "Failed to list fleet sandboxes")
+			return
+		}
+		ready := 0
+		for _, dep := range deps.Items {
+			if dep.Status.AvailableReplicas >= 1 {
+				ready++
+			}
+		}
+		fleets = append(fleets, gin.H{
+			"name":     spec.Name,
+			"replicas": spec.Replicas,
+			"current":  len(deps.Items),
+			"ready":    ready,
+			"image":    spec.Template.Image,
+			"revision": spec.revision(),
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"fleets": fleets, "count": len(fleets)})
+}
+
+// deleteHandler removes a fleet spec and all of its sandboxes
+func (f *fleetReconciler) deleteHandler(c *gin.Context) {
+	name := c.Param("name")
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Minute)
+	defer cancel()
+
+	n, err := f.rdb.HDel(ctx, fleetSpecsKey, name).Result()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, ash.CodeRedisError, "Failed to delete fleet spec")
+		return
+	}
+	if n == 0 {
+		respondError(c, http.StatusNotFound, ash.CodeNotFound, "fleet not found")
+		return
+	}
+
+	deps, err := f.clientset.AppsV1().Deployments(f.config.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fleetSelector(name),
+	})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, ash.CodeKubernetesError, "Fleet deleted but listing its sandboxes failed")
+		return
+	}
+	for i := range deps.Items {
+		f.remove(ctx, &deps.Items[i])
+	}
+	log.Printf("Deleted fleet %s and %d sandboxes", name, len(deps.Items))
+	c.JSON(http.StatusOK, gin.H{"message": "Fleet deleted", "name": name, "count": len(deps.Items)})
+}
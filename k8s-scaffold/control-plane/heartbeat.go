@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/rl-sandbox/k8s-pkg/ash"
+	"github.com/rl-sandbox/k8s-pkg/logging"
+	"github.com/rl-sandbox/k8s-pkg/store"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// heartbeatLockKey ensures only one control-plane replica runs the monitor per interval
+const heartbeatLockKey = "ash:lock:heartbeat-monitor"
+
+// newHeartbeatToken returns the secret a sandbox authenticates its heartbeats with,
+// empty when heartbeats are disabled
+func newHeartbeatToken(config *Config) string {
+	if config.HeartbeatIntervalSec <= 0 {
+		return ""
+	}
+	return strings.ReplaceAll(uuid.NewString(), "-", "")
+}
+
+// heartbeatEnv returns the env vars that tell an in-sandbox heartbeat client where to report
+func heartbeatEnv(config *Config, sandboxUUID, token string) []corev1.EnvVar {
+	if config.HeartbeatIntervalSec <= 0 {
+		return nil
+	}
+	return []corev1.EnvVar{
+		{Name: "ASH_SANDBOX_UUID", Value: sandboxUUID},
+		{Name: "ASH_HEARTBEAT_URL", Value: fmt.Sprintf("%s/heartbeat/%s", strings.TrimRight(config.SelfURL, "/"), sandboxUUID)},
+		{Name: "ASH_HEARTBEAT_INTERVAL_SEC", Value: fmt.Sprint(config.HeartbeatIntervalSec)},
+		{Name: "ASH_HEARTBEAT_TOKEN", Value: token},
+	}
+}
+
+// heartbeatReq is the optional body of a heartbeat
+type heartbeatReq struct {
+	Pod string `json:"pod"` // Reporting pod name, used to detect restarts
+}
+
+// heartbeatHandler records liveness pings sent by sandboxes. Each ping must carry
+// the sandbox's token as "Authorization: Bearer <token>". Sandboxes created
+// without a token are refused unless HEARTBEAT_REQUIRE_TOKEN is off.
+func heartbeatHandler(config *Config, sandboxes *store.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uuid := c.Param("uuid")
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+
+		var req heartbeatReq
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				respondError(c, http.StatusBadRequest, ash.CodeInvalidRequest, err.Error())
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+		defer cancel()
+
+		r, err := sandboxes.Heartbeat(ctx, uuid, req.Pod, token, config.HeartbeatRequireToken)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				respondError(c, http.StatusNotFound, ash.CodeNotFound, "UUID not found")
+				return
+			}
+			if errors.Is(err, store.ErrBadToken) {
+				respondError(c, http.StatusForbidden, ash.CodeForbidden, "Invalid heartbeat token")
+				return
+			}
+			logging.Errorf("Failed to record heartbeat for %s: %v", uuid, err)
+			respondError(c, http.StatusInternalServerError, ash.CodeRedisError, "Failed to record heartbeat")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"uuid": uuid, "status": r.Status})
+	}
+}
+
+// runHeartbeatMonitor periodically flags sandboxes that stopped heartbeating as
+// unresponsive and, if configured, restarts their pods. Sandboxes that never sent
+// a heartbeat are ignored so images without a client are unaffected. With sharding
+// every instance checks its own UUIDs instead of one replica checking all of them.
+func runHeartbeatMonitor(ctx context.Context, config *Config, rdb *redis.Client, sandboxes *store.Store, clientset *kubernetes.Clientset, shards *shardRing) {
+	interval := time.Duration(config.HeartbeatIntervalSec) * time.Second
+	threshold := interval * time.Duration(config.HeartbeatMissed)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Skip this round if another replica holds the lock
+		if shards == nil {
+			ok, err := rdb.SetNX(ctx, heartbeatLockKey, "1", interval).Result()
+			if err != nil || !ok {
+				continue
+			}
+		}
+
+		iter := sandboxes.Scan(ctx, "*")
+		for iter.Next(ctx) {
+			uuid := strings.TrimPrefix(iter.Val(), sandboxes.Prefix())
+			if !shards.owns(uuid) {
+				continue
+			}
+			r, err := sandboxes.Get(ctx, uuid)
+			if err != nil || r.LastHeartbeat.IsZero() || r.Status == store.StatusUnresponsive {
+				continue
+			}
+			if time.Since(r.LastHeartbeat) < threshold {
+				continue
+			}
+
+			logging.Warnf("Sandbox %s missed heartbeats (last=%s), marking unresponsive", uuid, r.LastHeartbeat.Format(time.RFC3339))
+			if err := sandboxes.SetStatus(ctx, uuid, store.StatusUnresponsive); err != nil {
+				logging.Errorf("Failed to mark %s unresponsive: %v", uuid, err)
+				continue
+			}
+
+			if config.HeartbeatRestart && restartSandboxPods(ctx, clientset, r.Host) {
+				if err := sandboxes.MarkRestarted(ctx, uuid); err != nil {
+					logging.Errorf("Failed to mark %s restarted: %v", uuid, err)
+				}
+			}
+		}
+		if err := iter.Err(); err != nil {
+			logging.Errorf("Heartbeat monitor scan error: %v", err)
+		}
+	}
+}
+
+// restartSandboxPods deletes the pods behind a sandbox host so its Deployment recreates them,
+// reporting whether the pods were deleted
+func restartSandboxPods(ctx context.Context, clientset *kubernetes.Clientset, host string) bool {
+	parts := strings.Split(host, ".")
+	if len(parts) < 2 {
+		return false
+	}
+	name, namespace := parts[0], parts[1]
+	err := clientset.CoreV1().Pods(namespace).DeleteCollection(ctx, metav1.DeleteOptions{}, metav1.ListOptions{
+		LabelSelector: "app=" + name,
+	})
+	if err != nil {
+		logging.Errorf("Failed to restart pods for %s/%s: %v", namespace, name, err)
+		return false
+	}
+	log.Printf("Restarted pods for unresponsive sandbox %s/%s", namespace, name)
+	return true
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rl-sandbox/k8s-pkg/ash"
+	"github.com/rl-sandbox/k8s-pkg/logging"
+	"github.com/rl-sandbox/k8s-pkg/store"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	linkType      = "sandbox-link"
+	linkFromLabel = "link-from"
+	linkToLabel   = "link-to"
+)
+
+// LinkReq declares that sandbox From may reach sandbox To
+type LinkReq struct {
+	From          string `json:"from" binding:"required"` // Source sandbox UUID
+	To            string `json:"to" binding:"required"`   // Target sandbox UUID
+	Ports         []int  `json:"ports"`                   // Allowed target ports, empty = all
+	Bidirectional bool   `json:"bidirectional"`           // Also allow To -> From
+	FromAlias     string `json:"from_alias"`              // Name of From in To's env, default From's sandbox name
+	ToAlias       string `json:"to_alias"`                // Name of To in From's env, default To's sandbox name
+	InjectEnv     *bool  `json:"inject_env"`              // Inject peer addresses as env (restarts both pods), default false
+}
+
+// linkedSandbox is one end of a link resolved from its Redis record
+type linkedSandbox struct {
+	uuid      string
+	name      string
+	namespace string
+	record    *store.Record
+}
+
+var envNameInvalid = regexp.MustCompile(`[^A-Z0-9_]`)
+
+// peerEnvPrefix returns the env var prefix for a peer alias, e.g. ASH_PEER_VICTIM
+func peerEnvPrefix(alias string) string {
+	return "ASH_PEER_" + envNameInvalid.ReplaceAllString(strings.ToUpper(alias), "_")
+}
+
+// linkName names the NetworkPolicy admitting from -> to
+func linkName(from, to string) string {
+	return fmt.Sprintf("link-%s-to-%s", from, to)
+}
+
+// resolveLinked loads a sandbox by UUID and derives its resource name from the host
+func resolveLinked(ctx context.Context, sandboxes *store.Store, uuid string) (*linkedSandbox, error) {
+	r, err := sandboxes.Get(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(r.Host, ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid host format for %s", uuid)
+	}
+	return &linkedSandbox{uuid: uuid, name: parts[0], namespace: parts[1], record: r}, nil
+}
+
+// buildLinkPolicy admits traffic from one sandbox's pods to another's
+func buildLinkPolicy(from, to *linkedSandbox, ports []int) *networkingv1.NetworkPolicy {
+	var policyPorts []networkingv1.NetworkPolicyPort
+	for _, p := range ports {
+		port := intstr.FromInt(p)
+		proto := corev1.ProtocolTCP
+		policyPorts = append(policyPorts, networkingv1.NetworkPolicyPort{Protocol: &proto, Port: &port})
+	}
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      linkName(from.name, to.name),
+			Namespace: to.namespace,
+			Labels: map[string]string{
+				"from":        "control-plane",
+				"type":        linkType,
+				linkFromLabel: from.name,
+				linkToLabel:   to.name,
+			},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": to.name}},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					From:  []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": from.name}}}},
+					Ports: policyPorts,
+				},
+				// Selecting the pod isolates it, so keep it reachable for the platform itself
+				{
+					From: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{
+						MatchExpressions: []metav1.LabelSelectorRequirement{{
+							Key:      "app",
+							Operator: metav1.LabelSelectorOpIn,
+							Values:   []string{"gateway", "control-plane"},
+						}},
+					}}},
+				},
+			},
+		},
+	}
+}
+
+// injectPeerEnv sets the peer's address on the sandbox container, which rolls its pod.
+// The deployment is re-read and the update retried when another writer got there first.
+// The container env from before the update is returned so a failed link can restore it.
+func injectPeerEnv(ctx context.Context, clientset *kubernetes.Clientset, target, peer *linkedSandbox, alias string) ([]corev1.EnvVar, error) {
+	prefix := peerEnvPrefix(alias)
+	var previous []corev1.EnvVar
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		dep, err := clientset.AppsV1().Deployments(target.namespace).Get(ctx, target.name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		vars := map[string]string{
+			prefix + "_HOST": peer.record.Host,
+			prefix + "_PORT": fmt.Sprint(peer.record.PortOrDefault()),
+		}
+
+		container := &dep.Spec.Template.Spec.Containers[0]
+		previous = append([]corev1.EnvVar(nil), container.Env...)
+		for i := range container.Env {
+			if v, ok := vars[container.Env[i].Name]; ok {
+				container.Env[i].Value = v
+				delete(vars, container.Env[i].Name)
+			}
+		}
+		for _, k := range []string{prefix + "_HOST", prefix + "_PORT"} {
+			if v, ok := vars[k]; ok {
+				container.Env = append(container.Env, corev1.EnvVar{Name: k, Value: v})
+			}
+		}
+		_, err = clientset.AppsV1().Deployments(target.namespace).Update(ctx, dep, metav1.UpdateOptions{})
+		return err
+	})
+	return previous, err
+}
+
+// restorePeerEnv puts back the container env injectPeerEnv replaced, rolling the pod again
+func restorePeerEnv(clientset *kubernetes.Clientset, target *linkedSandbox, env []corev1.EnvVar) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		dep, err := clientset.AppsV1().Deployments(target.namespace).Get(ctx, target.name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		dep.Spec.Template.Spec.Containers[0].Env = env
+		_, err = clientset.AppsV1().Deployments(target.namespace).Update(ctx, dep, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		logging.Errorf("Failed to roll back peer env on %s: %v", target.name, err)
+	}
+}
+
+// markRolled records the pod replacement so the heartbeat monitor gives the new pod a
+// fresh start instead of flagging the sandbox unresponsive mid-roll
+func markRolled(ctx context.Context, sandboxes *store.Store, target *linkedSandbox) {
+	if err := sandboxes.MarkRestarted(ctx, target.uuid); err != nil {
+		logging.Errorf("Failed to mark %s restarted: %v", target.uuid, err)
+	}
+}
+
+// deleteLinkPolicies removes policies created by a link request that failed part way
+func deleteLinkPolicies(clientset *kubernetes.Clientset, policies []*networkingv1.NetworkPolicy) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, np := range policies {
+		err := clientset.NetworkingV1().NetworkPolicies(np.Namespace).Delete(ctx, np.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			logging.Errorf("Failed to roll back network policy %s: %v", np.Name, err)
+		}
+	}
+}
+
+// createLinkHandler declares a link between two sandboxes
+func createLinkHandler(sandboxes *store.Store, clientset *kubernetes.Clientset) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req LinkReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondError(c, http.StatusBadRequest, ash.CodeInvalidRequest, err.Error())
+			return
+		}
+		for _, p := range req.Ports {
+			if p <= 0 || p > 65535 {
+				respondError(c, http.StatusBadRequest, ash.CodeInvalidRequest, fmt.Sprintf("invalid port %d", p))
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		from, err := resolveLinked(ctx, sandboxes, req.From)
+		if err != nil {
+			respondError(c, http.StatusNotFound, ash.CodeNotFound, fmt.Sprintf("sandbox %s not found", req.From))
+			return
+		}
+		to, err := resolveLinked(ctx, sandboxes, req.To)
+		if err != nil {
+			respondError(c, http.StatusNotFound, ash.CodeNotFound, fmt.Sprintf("sandbox %s not found", req.To))
+			return
+		}
+		if from.name == to.name {
+			respondError(c, http.StatusBadRequest, ash.CodeInvalidRequest, "cannot link a sandbox to itself")
+			return
+		}
+
+		policies := []*networkingv1.NetworkPolicy{buildLinkPolicy(from, to, req.Ports)}
+		if req.Bidirectional {
+			policies = append(policies, buildLinkPolicy(to, from, req.Ports))
+		}
+		// Policies that already existed belong to an earlier link and survive a rollback
+		var names []string
+		var created []*networkingv1.NetworkPolicy
+		for _, np := range policies {
+			_, err := clientset.NetworkingV1().NetworkPolicies(np.Namespace).Create(ctx, np, metav1.CreateOptions{})
+			if err != nil && !apierrors.IsAlreadyExists(err) {
+				logging.Errorf("Failed to create network policy %s: %v", np.Name, err)
+				deleteLinkPolicies(clientset, created)
+				respondError(c, http.StatusInternalServerError, ash.CodeKubernetesError, fmt.Sprintf("Failed to create network policy: %v", err))
+				return
+			}
+			if err == nil {
+				created = append(created, np)
+			}
+			names = append(names, np.Name)
+		}
+
+		if req.InjectEnv != nil && *req.InjectEnv {
+			fromAlias, toAlias := req.FromAlias, req.ToAlias
+			if fromAlias == "" {
+				fromAlias = from.name
+			}
+			if toAlias == "" {
+				toAlias = to.name
+			}
+			previous, err := injectPeerEnv(ctx, clientset, from, to, toAlias)
+			if err == nil {
+				if _, err = injectPeerEnv(ctx, clientset, to, from, fromAlias); err != nil {
+					restorePeerEnv(clientset, from, previous)
+					markRolled(ctx, sandboxes, from)
+				}
+			}
+			if err != nil {
+				logging.Errorf("Failed to inject peer env for link %s -> %s: %v", from.name, to.name, err)
+				deleteLinkPolicies(clientset, created)
+				respondError(c, http.StatusInternalServerError, ash.CodeKubernetesError, fmt.Sprintf("Peer env injection failed, link not created: %v", err))
+				return
+			}
+			markRolled(ctx, sandboxes, from)
+			markRolled(ctx, sandboxes, to)
+		}
+
+		log.Printf("Linked sandbox %s -> %s (bidirectional=%t)", from.name, to.name, req.Bidirectional)
+		c.JSON(http.StatusOK, gin.H{"links": names, "from": req.From, "to": req.To})
+	}
+}
+
+// listLinksHandler lists declared links
+func listLinksHandler(config *Config, clientset *kubernetes.Clientset) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		policies, err := clientset.NetworkingV1().NetworkPolicies(config.Namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: "from=control-plane,type=" + linkType,
+		})
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, ash.CodeKubernetesError, "Failed to list links")
+			return
+		}
+		links := make([]gin.H, 0, len(policies.Items))
+		for _, np := range policies.Items {
+			links = append(links, gin.H{"name": np.Name, "from": np.Labels[linkFromLabel], "to": np.Labels[linkToLabel]})
+		}
+		c.JSON(http.StatusOK, gin.H{"links": links, "count": len(links)})
+	}
+}
+
+// deleteLinkHandler removes one link by name. Injected env vars are left in place.
+func deleteLinkHandler(config *Config, clientset *kubernetes.Clientset) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+
+		np, err := clientset.NetworkingV1().NetworkPolicies(config.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil || np.Labels["type"] != linkType {
+			respondError(c, http.StatusNotFound, ash.CodeNotFound, "link not found")
+			return
+		}
+		if err := clientset.NetworkingV1().NetworkPolicies(config.Namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+			respondError(c, http.StatusInternalServerError, ash.CodeKubernetesError, fmt.Sprintf("Failed to delete link: %v", err))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Link deleted", "name": name})
+	}
+}
+
+// deleteSandboxLinks removes every link to or from a sandbox being deprovisioned
+func deleteSandboxLinks(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string) {
+	for _, label := range []string{linkFromLabel, linkToLabel} {
+		err := clientset.NetworkingV1().NetworkPolicies(namespace).DeleteCollection(ctx, metav1.DeleteOptions{}, metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("from=control-plane,type=%s,%s=%s", linkType, label, name),
+		})
+		if err != nil {
+			logging.Errorf("Failed to delete links of %s/%s: %v", namespace, name, err)
+		}
+	}
+}
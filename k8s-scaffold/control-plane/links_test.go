@@ -0,0 +1,17 @@
+package main
+
+import "testing"
+
+func TestPeerEnvPrefix(t *testing.T) {
+	for alias, want := range map[string]string{
+		"victim":         "ASH_PEER_VICTIM",
+		"sandbox-abc123": "ASH_PEER_SANDBOX_ABC123",
+		"db.primary":     "ASH_PEER_DB_PRIMARY",
+		"Web Server":     "ASH_PEER_WEB_SERVER",
+		"ALREADY_OK_1":   "ASH_PEER_ALREADY_OK_1",
+	} {
+		if got := peerEnvPrefix(alias); got != want {
+			t.Errorf("peerEnvPrefix(%q) = %q, want %q", alias, got, want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// logger returns a named sub-logger for a control-plane component
+func logger(component string) *slog.Logger {
+	return slog.Default().With("component", component)
+}
+
+// requestLogger logs each HTTP request through slog, replacing gin's text access log
+func requestLogger() gin.HandlerFunc {
+	l := logger("http")
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		l.Info("request",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"latency", time.Since(start).String(),
+			"client_ip", c.ClientIP(),
+		)
+	}
+}
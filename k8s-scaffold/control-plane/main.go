@@ -8,19 +8,17 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
-	"github.com/google/uuid"
-	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
-	appsv1 "k8s.io/api/apps/v1"
-	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
+	"github.com/rl-sandbox/k8s-pkg/ash"
+	"github.com/rl-sandbox/k8s-pkg/chaos"
+	"github.com/rl-sandbox/k8s-pkg/logging"
+	"github.com/rl-sandbox/k8s-pkg/settings"
+	"github.com/rl-sandbox/k8s-pkg/store"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes"
@@ -41,6 +39,25 @@ type SpawnReq struct {
 	Env          map[string]string `json:"env"`
 	Resources    ResourceReq       `json:"resources"`
 	NodeSelector map[string]string `json:"node_selector"`
+	Owner        string            `json:"owner"`
+	Labels       map[string]string `json:"labels"`
+	TTLSeconds   int               `json:"ttl_seconds"`
+	ExperimentID string            `json:"experiment_id"`
+
+	DNS         *DNSReq        `json:"dns"`          // Custom nameservers, search domains and resolver options
+	HostAliases []HostAliasReq `json:"host_aliases"` // Extra /etc/hosts entries
+
+	Bandwidth *BandwidthReq `json:"bandwidth"` // Ingress/egress traffic shaping
+
+	Timezone string `json:"timezone"` // IANA zone set as TZ, e.g. Europe/Berlin
+	Locale   string `json:"locale"`   // Locale set as LANG and LC_ALL, e.g. en_US.UTF-8
+
+	// Shell command that must succeed before the sandbox counts as ready, replacing the TCP port check
+	ReadinessCommand string `json:"readiness_command"`
+
+	WorkspaceSource string `json:"workspace_source"` // s3:// or gs:// .tar.gz unpacked before the sandbox starts
+	WorkspaceExport string `json:"workspace_export"` // s3:// or gs:// object the workspace is uploaded to at deprovision
+	WorkspaceDir    string `json:"workspace_dir"`    // Workspace mount path in the sandbox, default WORKSPACE_DIR
 }
 
 type ResourceReq struct {
@@ -66,6 +83,17 @@ type SpawnResp struct {
 	Ports            []int  `json:"ports,omitempty"`
 	NodePorts        []int  `json:"node_ports,omitempty"`
 	Message          string `json:"message,omitempty"`
+	FailureStage     string `json:"failure_stage,omitempty"` // Set when the sandbox did not become ready, see the stage* constants
+	Retryable        bool   `json:"retryable,omitempty"`     // Whether spawning again with the same request may succeed
+
+	Image     string            `json:"image,omitempty"`
+	Owner     string            `json:"owner,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	CreatedAt string            `json:"created_at,omitempty"`
+	ExpiresAt string            `json:"expires_at,omitempty"`
+	Warnings  []string          `json:"warnings,omitempty"`
+
+	ExperimentID string `json:"experiment_id,omitempty"`
 }
 
 // Configuration holds all the environment-based configuration
@@ -77,37 +105,131 @@ type Config struct {
 	RedisPort          int
 	RedisDB            int
 	ServiceAccountName string
+	SandboxTTLSec      int    // Default lifetime of sandbox Redis records, 0 = no expiry
+	RedisKeyPrefix     string // Sandbox record key prefix, shared with the gateway
+
+	WarmPoolImage        string // Image kept pre-started in the warm pool, empty = pool disabled
+	WarmPoolPort         int    // Container port of pooled sandboxes
+	WarmPoolMin          int    // Minimum pooled sandboxes
+	WarmPoolMax          int    // Maximum pooled sandboxes
+	WarmPoolWindowSec    int    // Window over which spawn demand is measured
+	WarmPoolReconcileSec int    // How often the pool size is reconciled
+
+	SelfURL              string // URL sandboxes use to reach this control-plane
+	HeartbeatIntervalSec int    // Expected sandbox heartbeat interval, 0 = heartbeats disabled
+	HeartbeatMissed      int    // Missed heartbeats before a sandbox is flagged unresponsive
+	HeartbeatRestart     bool   // Restart pods of unresponsive sandboxes
+
+	HeartbeatRequireToken bool // Refuse heartbeats for sandboxes created without a token, default true
+
+	GatewayURL string // Gateway base URL scraped by /admin/overview, empty = skip
+
+	ChaosEnabled bool // Mount the /admin/chaos fault injection API (admin listener) and middleware, test clusters only
+
+	AdminAddr string // Listen address for operator-only endpoints (/admin/chaos), kept off the API port, default :9090
+
+	WorkspaceSyncImage         string // rclone image used to seed and export workspaces
+	WorkspaceDir               string // Default workspace mount path in sandboxes
+	WorkspaceCredentialsSecret string // Secret with object-store credentials (AWS_*/GOOGLE_*), optional
+	WorkspaceExportGraceSec    int    // Termination grace period for sandboxes that export their workspace
+
+	ImageScanMode        string // off, warn or enforce
+	ImageScanServer      string // Trivy server URL
+	ImageScanThresholds  string // Max vulnerabilities per severity, e.g. CRITICAL=0,HIGH=5
+	ImageScanTimeoutSec  int    // Max time for one scan
+	ImageScanCacheSec    int    // How long results are cached per digest
+	ImageScanTagCacheSec int    // How long a tag is assumed to point at the same digest
+
+	ImageVerify           bool   // Require a trusted cosign signature on sandbox images
+	ImageVerifyKeys       string // Comma-separated cosign public key paths or KMS URIs
+	ImageVerifyIdentity   string // Keyless signer identity (regexp), optional
+	ImageVerifyIssuer     string // OIDC issuer for keyless signatures
+	ImageVerifyTimeoutSec int    // Max time for one verification
+	ImageVerifyCacheSec   int    // How long a successful verification is reused
+
+	FleetReconcileSec int // How often applied fleet specs are enforced
+	FleetMaxReplicas  int // Upper bound on replicas in one fleet spec
+
+	Sharding      bool   // Split UUIDs and fleets across control-plane instances by consistent hashing
+	ShardID       string // This instance's ring member ID, default hostname
+	ShardURL      string // URL other instances forward misrouted requests to
+	ShardVnodes   int    // Virtual nodes per instance on the hash ring
+	ShardLeaseSec int    // Membership lease, instances that stop renewing leave the ring
+
+	ExecBufferBytes       int // Shell output kept per sandbox for run_command/get_output
+	ExecCommandTimeoutSec int // Default max wait for a run_command to finish
+	ExecIdleSec           int // Shells unused for this long are detached
+
+	StatusCacheResyncSec int // Full resync period of the Deployment status cache, 0 = watch only
 }
 
-// getEnv returns the environment variable value or a default
-func getEnv(key, defaultVal string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
-	}
-	return defaultVal
-}
-
-// getEnvInt returns the environment variable as int or a default
-func getEnvInt(key string, defaultVal int) int {
-	if v := os.Getenv(key); v != "" {
-		if n, err := strconv.Atoi(v); err == nil {
-			return n
-		}
-		log.Printf("Warning: invalid integer value for %s: %s, using default %d", key, v, defaultVal)
-	}
-	return defaultVal
-}
-
-// LoadConfig loads configuration from environment variables
+// LoadConfig loads configuration from the config file, environment variables and flags
 func LoadConfig() *Config {
+	hostname, _ := os.Hostname()
 	return &Config{
-		Namespace:          getEnv("TARGET_NAMESPACE", "ash"),
-		WaitDeployReadySec: getEnvInt("WAIT_DEPLOY_READY_SEC", 120),
-		WaitSvcIPSec:       getEnvInt("WAIT_SVC_IP_SEC", 120),
-		RedisHost:          getEnv("REDIS_HOST", "localhost"),
-		RedisPort:          getEnvInt("REDIS_PORT", 6379),
-		RedisDB:            getEnvInt("REDIS_DB", 0),
-		ServiceAccountName: getEnv("SERVICE_ACCOUNT_NAME", "default"),
+		Namespace:          settings.String("TARGET_NAMESPACE", "ash"),
+		WaitDeployReadySec: settings.Int("WAIT_DEPLOY_READY_SEC", 120),
+		WaitSvcIPSec:       settings.Int("WAIT_SVC_IP_SEC", 120),
+		RedisHost:          settings.String("REDIS_HOST", "localhost"),
+		RedisPort:          settings.Int("REDIS_PORT", 6379),
+		RedisDB:            settings.Int("REDIS_DB", 0),
+		ServiceAccountName: settings.String("SERVICE_ACCOUNT_NAME", "default"),
+		SandboxTTLSec:      settings.Int("SANDBOX_TTL_SEC", 0),
+		RedisKeyPrefix:     settings.String("ROUTE_KEY_PREFIX", store.DefaultKeyPrefix),
+
+		WarmPoolImage:        settings.String("WARM_POOL_IMAGE", ""),
+		WarmPoolPort:         settings.Int("WARM_POOL_PORT", 3000),
+		WarmPoolMin:          settings.Int("WARM_POOL_MIN", 0),
+		WarmPoolMax:          settings.Int("WARM_POOL_MAX", 10),
+		WarmPoolWindowSec:    settings.Int("WARM_POOL_WINDOW_SEC", 60),
+		WarmPoolReconcileSec: settings.Int("WARM_POOL_RECONCILE_SEC", 15),
+
+		SelfURL:              settings.String("CONTROL_PLANE_URL", "http://control-plane.ash.svc.cluster.local"),
+		HeartbeatIntervalSec: settings.Int("HEARTBEAT_INTERVAL_SEC", 0),
+		HeartbeatMissed:      settings.Int("HEARTBEAT_MISSED", 3),
+		HeartbeatRestart:     settings.Bool("HEARTBEAT_RESTART", false),
+
+		HeartbeatRequireToken: settings.Bool("HEARTBEAT_REQUIRE_TOKEN", true),
+
+		GatewayURL: settings.String("GATEWAY_URL", "http://gateway.ash.svc.cluster.local"),
+
+		ChaosEnabled: settings.Bool("CHAOS_ENABLED", false),
+
+		AdminAddr: settings.String("ADMIN_ADDR", ":9090"),
+
+		WorkspaceSyncImage:         settings.String("WORKSPACE_SYNC_IMAGE", "rclone/rclone:1.68"),
+		WorkspaceDir:               settings.String("WORKSPACE_DIR", "/workspace"),
+		WorkspaceCredentialsSecret: settings.String("WORKSPACE_CREDENTIALS_SECRET", ""),
+		WorkspaceExportGraceSec:    settings.Int("WORKSPACE_EXPORT_GRACE_SEC", 300),
+
+		ImageScanMode:        strings.ToLower(settings.String("IMAGE_SCAN_MODE", scanModeOff)),
+		ImageScanServer:      settings.String("IMAGE_SCAN_SERVER", ""),
+		ImageScanThresholds:  settings.String("IMAGE_SCAN_THRESHOLDS", "CRITICAL=0"),
+		ImageScanTimeoutSec:  settings.Int("IMAGE_SCAN_TIMEOUT_SEC", 120),
+		ImageScanCacheSec:    settings.Int("IMAGE_SCAN_CACHE_SEC", 86400),
+		ImageScanTagCacheSec: settings.Int("IMAGE_SCAN_TAG_CACHE_SEC", 600),
+
+		ImageVerify:           settings.Bool("IMAGE_VERIFY", false),
+		ImageVerifyKeys:       settings.String("IMAGE_VERIFY_KEYS", ""),
+		ImageVerifyIdentity:   settings.String("IMAGE_VERIFY_IDENTITY_REGEXP", ""),
+		ImageVerifyIssuer:     settings.String("IMAGE_VERIFY_OIDC_ISSUER", ""),
+		ImageVerifyTimeoutSec: settings.Int("IMAGE_VERIFY_TIMEOUT_SEC", 60),
+		ImageVerifyCacheSec:   settings.Int("IMAGE_VERIFY_CACHE_SEC", 600),
+
+		FleetReconcileSec: settings.Int("FLEET_RECONCILE_SEC", 15),
+		FleetMaxReplicas:  settings.Int("FLEET_MAX_REPLICAS", 500),
+
+		Sharding:      settings.Bool("SHARDING", false),
+		ShardID:       settings.String("SHARD_ID", hostname),
+		ShardURL:      settings.String("SHARD_ADVERTISE_URL", ""),
+		ShardVnodes:   settings.Int("SHARD_VNODES", 64),
+		ShardLeaseSec: settings.Int("SHARD_LEASE_SEC", 15),
+
+		ExecBufferBytes:       settings.Int("EXEC_BUFFER_BYTES", 1<<20),
+		ExecCommandTimeoutSec: settings.Int("EXEC_COMMAND_TIMEOUT_SEC", 300),
+		ExecIdleSec:           settings.Int("EXEC_IDLE_SEC", 900),
+
+		StatusCacheResyncSec: settings.Int("STATUS_CACHE_RESYNC_SEC", 0),
 	}
 }
 
@@ -121,8 +243,8 @@ func randSuffix(n int) string {
 	return string(b)
 }
 
-// Get Kubernetes client from in-cluster or kubeconfig
-func getK8sClient() (*kubernetes.Clientset, error) {
+// Get Kubernetes client and its REST config from in-cluster or kubeconfig
+func getK8sClient() (*kubernetes.Clientset, *rest.Config, error) {
 	var config *rest.Config
 	var err error
 
@@ -136,17 +258,17 @@ func getK8sClient() (*kubernetes.Clientset, error) {
 		}
 		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create k8s config: %w", err)
+			return nil, nil, fmt.Errorf("failed to create k8s config: %w", err)
 		}
 	}
 
 	// Create clientset
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create k8s client: %w", err)
+		return nil, nil, fmt.Errorf("failed to create k8s client: %w", err)
 	}
 
-	return clientset, nil
+	return clientset, config, nil
 }
 
 // Create a Redis client
@@ -159,7 +281,14 @@ func createRedisClient(config *Config) *redis.Client {
 
 func main() {
 	// Load configuration
+	if err := settings.Load(); err != nil {
+		log.Fatalf("Config error: %v", err)
+	}
+	jsonLogs := logging.Setup("control-plane")
 	config := LoadConfig()
+	if err := config.validate(); err != nil {
+		logging.Fatalf("%v", err)
+	}
 
 	// Create Redis client
 	rdb := createRedisClient(config)
@@ -169,13 +298,24 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := rdb.Ping(ctx).Err(); err != nil {
-		log.Fatalf("Failed to connect to Redis: %v", err)
+		logging.Fatalf("Failed to connect to Redis: %v", err)
+	}
+
+	// Upgrade route records written by older releases
+	sandboxes := store.New(rdb, config.RedisKeyPrefix)
+	migrateCtx, migrateCancel := context.WithTimeout(context.Background(), time.Minute)
+	n, err := sandboxes.Migrate(migrateCtx)
+	migrateCancel()
+	if err != nil {
+		logging.Errorf("Warning: Redis schema migration failed: %v", err)
+	} else if n > 0 {
+		log.Printf("Migrated %d sandbox records to schema version %d", n, store.SchemaVersion)
 	}
 
 	// Create Kubernetes client once at startup (singleton pattern)
-	clientset, err := getK8sClient()
+	clientset, restConfig, err := getK8sClient()
 	if err != nil {
-		log.Fatalf("Failed to create Kubernetes client: %v", err)
+		logging.Fatalf("Failed to create Kubernetes client: %v", err)
 	}
 	log.Println("Kubernetes client initialized successfully")
 
@@ -183,7 +323,28 @@ func main() {
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 	r.Use(gin.Recovery())
-	r.Use(gin.Logger())
+	if jsonLogs {
+		r.Use(requestLogger())
+	} else {
+		r.Use(gin.Logger())
+	}
+
+	// Operator endpoints on a port that is not exposed through the API service
+	admin := gin.New()
+	admin.Use(gin.Recovery())
+
+	// Fault injection for resilience tests, never enable in production
+	if config.ChaosEnabled {
+		injector := &chaosInjector{rdb: rdb}
+		r.Use(injector.middleware())
+		admin.GET(chaos.AdminPath, injector.getHandler)
+		admin.PUT(chaos.AdminPath, injector.putHandler)
+		admin.DELETE(chaos.AdminPath, injector.deleteHandler)
+		chaosCtx, stopChaos := context.WithCancel(context.Background())
+		defer stopChaos()
+		go injector.run(chaosCtx)
+		log.Printf("Chaos fault injection enabled, rules at %s on the admin listener", chaos.AdminPath)
+	}
 
 	// Health check endpoints
 	r.GET("/healthz", func(c *gin.Context) {
@@ -202,11 +363,74 @@ func main() {
 		c.String(http.StatusOK, "ready")
 	})
 
+	// Effective configuration (secrets redacted)
+	r.GET("/configz", configzHandler(config))
+
+	// UUID shard ownership across control-plane instances
+	shards := newShardRing(config, rdb)
+	if shards != nil {
+		shardCtx, stopShards := context.WithCancel(context.Background())
+		defer stopShards()
+		go shards.run(shardCtx)
+		log.Printf("Sharding enabled: id=%s url=%s", config.ShardID, config.ShardURL)
+	}
+
+	// Sandbox liveness reports
+	if config.HeartbeatIntervalSec > 0 {
+		r.POST("/heartbeat/:uuid", shards.forwardToOwner("uuid"), heartbeatHandler(config, sandboxes))
+		monitorCtx, stopMonitor := context.WithCancel(context.Background())
+		defer stopMonitor()
+		go runHeartbeatMonitor(monitorCtx, config, rdb, sandboxes, clientset, shards)
+	}
+
+	// Signature verification for requested images
+	verifier := newImageVerifier(config, rdb)
+
+	// Warm pool autoscaler
+	pool := newWarmPool(config, rdb, clientset, verifier)
+	if pool != nil {
+		poolCtx, stopPool := context.WithCancel(context.Background())
+		defer stopPool()
+		go pool.run(poolCtx)
+	}
+
+	// Deployment status served from a watch instead of per-request API calls
+	deployments := newDeploymentCache(config, clientset)
+	cacheCtx, stopCache := context.WithCancel(context.Background())
+	defer stopCache()
+	go deployments.run(cacheCtx)
+	r.GET("/sandboxes", deployments.listHandler(sandboxes))
+	r.GET("/sandbox/:uuid", deployments.getHandler(sandboxes))
+
+	// Aggregated state for dashboards
+	r.GET("/admin/overview", adminOverviewHandler(config, sandboxes, deployments, pool))
+
+	// Vulnerability gate for requested images
+	scanner := newImageScanner(config, rdb)
+
+	sp := &spawner{
+		config:    config,
+		clientset: clientset,
+		sandboxes: sandboxes,
+		pool:      pool,
+		scanner:   scanner,
+		verifier:  verifier,
+	}
+
+	// Declarative fleets kept alive by the reconciler
+	fleets := &fleetReconciler{config: config, rdb: rdb, clientset: clientset, sandboxes: sandboxes, spawner: sp, shards: shards}
+	r.POST("/apply", fleets.applyHandler)
+	r.GET("/fleets", fleets.listHandler)
+	r.DELETE("/fleets/:name", fleets.deleteHandler)
+	fleetCtx, stopFleets := context.WithCancel(context.Background())
+	defer stopFleets()
+	go fleets.run(fleetCtx)
+
 	// Main API endpoints
 	r.POST("/spawn", func(c *gin.Context) {
 		var req SpawnReq
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			respondError(c, http.StatusBadRequest, ash.CodeInvalidRequest, err.Error())
 			return
 		}
 
@@ -214,260 +438,39 @@ func main() {
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Minute)
 		defer cancel()
 
-		name := req.Name
-		if name == "" {
-			name = fmt.Sprintf("sandbox-%s", randSuffix(12))
-		}
-		labels := map[string]string{"app": name, "from": "control-plane", "type": "sandbox"}
-
-		// 1) Deployment
-		var envVars []corev1.EnvVar
-		for k, v := range req.Env {
-			envVars = append(envVars, corev1.EnvVar{Name: k, Value: v})
-		}
-
-		var containerPorts []corev1.ContainerPort
-		for _, p := range req.Ports {
-			containerPorts = append(containerPorts, corev1.ContainerPort{ContainerPort: int32(p.ContainerPort)})
-		}
-		if len(containerPorts) == 0 {
-			containerPorts = append(containerPorts, corev1.ContainerPort{ContainerPort: 80})
-		}
-
-		// Determine the probe port (first container port, default 3000)
-		probePort := 3000
-		if len(containerPorts) > 0 {
-			probePort = int(containerPorts[0].ContainerPort)
-		}
-
-		// Create container with readiness probe
-		// The probe checks if MCP server is listening on the port
-		container := corev1.Container{
-			Name:  "sandbox",
-			Image: req.Image,
-			Ports: containerPorts,
-			Env:   envVars,
-			ReadinessProbe: &corev1.Probe{
-				ProbeHandler: corev1.ProbeHandler{
-					TCPSocket: &corev1.TCPSocketAction{
-						Port: intstrFromInt(probePort),
-					},
-				},
-				InitialDelaySeconds: 2,
-				PeriodSeconds:       3,
-				TimeoutSeconds:      1,
-				SuccessThreshold:    1,
-				FailureThreshold:    10,
-			},
-		}
-
-		// Add resource limits and requests if specified
-		if req.Resources.Requests.CPU != "" || req.Resources.Requests.Memory != "" ||
-			req.Resources.Limits.CPU != "" || req.Resources.Limits.Memory != "" {
-
-			container.Resources = corev1.ResourceRequirements{}
-
-			if req.Resources.Requests.CPU != "" || req.Resources.Requests.Memory != "" {
-				container.Resources.Requests = corev1.ResourceList{}
-				if req.Resources.Requests.CPU != "" {
-					qty, err := resource.ParseQuantity(req.Resources.Requests.CPU)
-					if err != nil {
-						c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid CPU request: %v", err)})
-						return
-					}
-					container.Resources.Requests[corev1.ResourceCPU] = qty
-				}
-				if req.Resources.Requests.Memory != "" {
-					qty, err := resource.ParseQuantity(req.Resources.Requests.Memory)
-					if err != nil {
-						c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid memory request: %v", err)})
-						return
-					}
-					container.Resources.Requests[corev1.ResourceMemory] = qty
-				}
-			}
-
-			if req.Resources.Limits.CPU != "" || req.Resources.Limits.Memory != "" {
-				container.Resources.Limits = corev1.ResourceList{}
-				if req.Resources.Limits.CPU != "" {
-					qty, err := resource.ParseQuantity(req.Resources.Limits.CPU)
-					if err != nil {
-						c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid CPU limit: %v", err)})
-						return
-					}
-					container.Resources.Limits[corev1.ResourceCPU] = qty
-				}
-				if req.Resources.Limits.Memory != "" {
-					qty, err := resource.ParseQuantity(req.Resources.Limits.Memory)
-					if err != nil {
-						c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid memory limit: %v", err)})
-						return
-					}
-					container.Resources.Limits[corev1.ResourceMemory] = qty
-				}
-			}
-		}
-
-		// Use client-provided node selector, or default if not provided
-		nodeSelector := req.NodeSelector
-		if nodeSelector == nil {
-			nodeSelector = map[string]string{
-				"kubernetes.io/os": "linux",
-			}
-		}
-
-		podSpec := corev1.PodSpec{
-			Containers:         []corev1.Container{container},
-			ServiceAccountName: config.ServiceAccountName,
-			NodeSelector:       nodeSelector,
-		}
-		dep := &appsv1.Deployment{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      name,
-				Namespace: config.Namespace,
-				Labels:    labels,
-			},
-			Spec: appsv1.DeploymentSpec{
-				Replicas: int32Ptr(1), // Always single replica
-				Selector: &metav1.LabelSelector{
-					MatchLabels: map[string]string{"app": name},
-				},
-				Template: corev1.PodTemplateSpec{
-					ObjectMeta: metav1.ObjectMeta{Labels: labels},
-					Spec:       podSpec,
-				},
-			},
-		}
-
-		// Create deployment with context
-		_, err = clientset.AppsV1().Deployments(config.Namespace).Create(ctx, dep, metav1.CreateOptions{})
-		if err != nil {
-			log.Printf("Failed to create deployment: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create deployment: %v", err)})
+		resp, status, apiErr := sp.spawn(ctx, req)
+		if apiErr != nil {
+			c.JSON(status, apiErr)
 			return
 		}
+		c.JSON(http.StatusOK, resp)
+	})
 
-		// 2) Create ClusterIP Service
-		var servicePorts []corev1.ServicePort
-		for _, p := range req.Ports {
-			servicePorts = append(servicePorts, corev1.ServicePort{
-				Port:       int32(p.ContainerPort),
-				TargetPort: intstrFromInt(p.ContainerPort),
-			})
-		}
-		if len(servicePorts) == 0 {
-			servicePorts = append(servicePorts, corev1.ServicePort{
-				Port:       80,
-				TargetPort: intstrFromInt(80),
-			})
-		}
-		svc := &corev1.Service{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      name,
-				Namespace: config.Namespace,
-				Labels:    labels,
-			},
-			Spec: corev1.ServiceSpec{
-				Type:     corev1.ServiceTypeClusterIP,
-				Selector: map[string]string{"app": name},
-				Ports:    servicePorts,
-			},
-		}
-		svcObj, err := clientset.CoreV1().Services(config.Namespace).Create(ctx, svc, metav1.CreateOptions{})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		// 3) Wait for Deployment Ready with exponential backoff
-		ready := false
-		backoff := 1 * time.Second
-		maxBackoff := 10 * time.Second
-		end := time.Now().Add(time.Duration(config.WaitDeployReadySec) * time.Second)
-
-		for time.Now().Before(end) {
-			cur, err := clientset.AppsV1().Deployments(config.Namespace).Get(ctx, name, metav1.GetOptions{})
-			if err == nil && cur.Status.AvailableReplicas >= 1 {
-				ready = true
-				break
-			}
-
-			// Use exponential backoff with jitter
-			jitter := time.Duration(rand.Int63n(int64(backoff) / 2))
-			sleepTime := backoff + jitter
-			time.Sleep(sleepTime)
-
-			// Increase backoff for next iteration
-			backoff *= 2
-			if backoff > maxBackoff {
-				backoff = maxBackoff
-			}
-		}
-
-		// 4) Collect Service Address (ClusterIP only)
-		var clusterIP string
-		var svcPorts []int
-		if svcObj != nil {
-			s, err := clientset.CoreV1().Services(config.Namespace).Get(ctx, name, metav1.GetOptions{})
-			if err == nil {
-				clusterIP = s.Spec.ClusterIP
-				for _, p := range s.Spec.Ports {
-					svcPorts = append(svcPorts, int(p.Port))
-				}
-			}
-		}
-
-		// Prepare Redis record
-		sandboxUUID := fmt.Sprintf("%s-%s", name, uuid.New().String())
-
-		sandboxStatus := "ready"
-		if !ready {
-			sandboxStatus = "starting"
-		}
-
-		sandboxPort := 0
-		if len(svcPorts) > 0 {
-			sandboxPort = svcPorts[0]
-		}
-
-		// Create Redis record with pipeline for efficiency
-		record := map[string]interface{}{
-			"uuid":   sandboxUUID,
-			"host":   fmt.Sprintf("%s.%s.svc.cluster.local", name, config.Namespace),
-			"port":   sandboxPort,
-			"status": sandboxStatus,
-		}
-
-		key := fmt.Sprintf("sandbox:%s", sandboxUUID)
-		pipe := rdb.Pipeline()
-		pipe.HSet(ctx, key, record)
-
-		if _, err := pipe.Exec(ctx); err != nil {
-			log.Printf("Failed to save sandbox record to Redis: %v", err)
-		}
-
-		log.Printf("Sandbox created: name=%s, uuid=%s, status=%s", name, sandboxUUID, sandboxStatus)
-
-		resp := SpawnResp{
-			Name:        name,
-			UUID:        sandboxUUID,
-			Namespace:   config.Namespace,
-			Status:      cases.Title(language.English).String(sandboxStatus),
-			ServiceType: "ClusterIP",
-			ClusterIP:   clusterIP,
-			Host:        fmt.Sprintf("%s.%s.svc.cluster.local", name, config.Namespace),
-			Ports:       svcPorts,
-		}
+	// Persistent shells for run_command/get_output parity with the hostagent.
+	// Shells live in this process, so every request for a UUID must reach its
+	// shard owner; without sharding, replicas would each hold a different shell.
+	var shells *shellManager
+	if shards != nil {
+		shells = newShellManager(config, clientset, restConfig, sandboxes)
+		r.POST("/sandbox/:uuid/run_command", shards.forwardToOwner("uuid"), shells.runCommandHandler)
+		r.GET("/sandbox/:uuid/output", shards.forwardToOwner("uuid"), shells.outputHandler)
+		r.DELETE("/sandbox/:uuid/shell", shards.forwardToOwner("uuid"), shells.closeShellHandler)
+		shellCtx, stopShells := context.WithCancel(context.Background())
+		defer stopShells()
+		go shells.reap(shellCtx)
+	} else {
+		log.Printf("Persistent shells disabled: run_command and get_output require SHARDING=true")
+	}
 
-		// Log status
-		status := "success"
-		if !ready {
-			status = "partial"
-		}
-		log.Printf("Spawn request completed with status: %s", status)
+	// Sandbox-to-sandbox network links
+	r.POST("/links", createLinkHandler(sandboxes, clientset))
+	r.GET("/links", listLinksHandler(config, clientset))
+	r.DELETE("/links/:name", deleteLinkHandler(config, clientset))
 
-		c.JSON(http.StatusOK, resp)
-	})
+	// Experiment-scoped bulk operations
+	r.GET("/experiments/:id", experimentListHandler(sandboxes))
+	r.GET("/experiments/:id/usage", experimentUsageHandler(config, sandboxes, clientset))
+	r.DELETE("/experiments/:id", experimentDeprovisionHandler(config, sandboxes, clientset))
 
 	r.DELETE("/deprovision-all", func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Minute)
@@ -482,8 +485,8 @@ func main() {
 			LabelSelector: selector,
 		})
 		if err != nil {
-			log.Printf("Failed to list deployments: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list deployments"})
+			logging.Errorf("Failed to list deployments: %v", err)
+			respondError(c, http.StatusInternalServerError, ash.CodeKubernetesError, "Failed to list deployments")
 			return
 		}
 
@@ -495,29 +498,30 @@ func main() {
 			// Delete service
 			if err := clientset.CoreV1().Services(namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
 				// Log but continue
-				log.Printf("Failed to delete service %s: %v", id, err)
+				logging.Errorf("Failed to delete service %s: %v", id, err)
 			}
 
 			// Delete deployment
 			if err := clientset.AppsV1().Deployments(namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
-				log.Printf("Failed to delete deployment %s: %v", id, err)
+				logging.Errorf("Failed to delete deployment %s: %v", id, err)
 			}
+			deleteSandboxLinks(ctx, clientset, namespace, name)
 
 			// Remove associated Redis keys: sandbox:<name>-*
-			pattern := fmt.Sprintf("sandbox:%s-*", name)
-			iter := rdb.Scan(ctx, 0, pattern, 0).Iterator()
+			pattern := name + "-*"
+			iter := sandboxes.Scan(ctx, pattern)
 			var redisDelErr bool
 			var anyDeleted bool
 			for iter.Next(ctx) {
 				key := iter.Val()
 				anyDeleted = true
 				if err := rdb.Del(ctx, key).Err(); err != nil {
-					log.Printf("Failed to delete Redis key %s for %s: %v", key, id, err)
+					logging.Errorf("Failed to delete Redis key %s for %s: %v", key, id, err)
 					redisDelErr = true
 				}
 			}
 			if err := iter.Err(); err != nil {
-				log.Printf("Error scanning Redis for pattern %s: %v", pattern, err)
+				logging.Errorf("Error scanning Redis for pattern %s: %v", pattern, err)
 				redisDelErr = true
 			}
 			// If no matching redis key found, that's not a fatal error; still consider succeeded.
@@ -541,27 +545,24 @@ func main() {
 		})
 	})
 
-	r.DELETE("/deprovision/:uuid", func(c *gin.Context) {
+	r.DELETE("/deprovision/:uuid", shards.forwardToOwner("uuid"), func(c *gin.Context) {
 		uuid := c.Param("uuid")
 
 		// Use request context with timeout
 		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
 		defer cancel()
 
-		key := fmt.Sprintf("sandbox:%s", uuid)
-		result, err := rdb.HGetAll(ctx, key).Result()
-		if err != nil || len(result) == 0 {
-			log.Printf("Deprovision failed: UUID %s not found", uuid)
-			c.JSON(http.StatusNotFound, gin.H{"error": "UUID not found"})
+		record, err := sandboxes.Get(ctx, uuid)
+		if err != nil {
+			logging.Errorf("Deprovision failed: UUID %s not found", uuid)
+			respondError(c, http.StatusNotFound, ash.CodeNotFound, "UUID not found")
 			return
 		}
 
-		name := result["host"]
-
-		parts := strings.Split(name, ".")
+		parts := strings.Split(record.Host, ".")
 		if len(parts) < 2 {
-			log.Printf("Deprovision failed: Invalid host format for UUID %s", uuid)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid host format"})
+			logging.Errorf("Deprovision failed: Invalid host format for UUID %s", uuid)
+			respondError(c, http.StatusBadRequest, ash.CodeInvalidRequest, "Invalid host format")
 			return
 		}
 		svcName := parts[0]
@@ -569,16 +570,18 @@ func main() {
 
 		// Delete resources sequentially
 		if err := clientset.CoreV1().Services(namespace).Delete(ctx, svcName, metav1.DeleteOptions{}); err != nil {
-			log.Printf("Failed to delete service %s: %v", svcName, err)
+			logging.Errorf("Failed to delete service %s: %v", svcName, err)
 		}
 
 		if err := clientset.AppsV1().Deployments(namespace).Delete(ctx, svcName, metav1.DeleteOptions{}); err != nil {
-			log.Printf("Failed to delete deployment %s: %v", svcName, err)
+			logging.Errorf("Failed to delete deployment %s: %v", svcName, err)
 		}
+		deleteSandboxLinks(ctx, clientset, namespace, svcName)
+		shells.closeSession(uuid)
 
 		// Delete Redis key
-		if err := rdb.Del(ctx, key).Err(); err != nil {
-			log.Printf("Failed to delete Redis key %s: %v", key, err)
+		if err := sandboxes.Delete(ctx, uuid); err != nil {
+			logging.Errorf("Failed to delete Redis key %s: %v", sandboxes.Key(uuid), err)
 		}
 
 		log.Printf("Successfully deprovisioned UUID %s", uuid)
@@ -590,10 +593,22 @@ func main() {
 		Handler: r,
 	}
 
-	// Start server in a goroutine
+	adminSrv := http.Server{
+		Addr:              config.AdminAddr,
+		Handler:           admin,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	// Start servers in goroutines
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start server: %v", err)
+			logging.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+	go func() {
+		log.Printf("Admin endpoints listening on %s", config.AdminAddr)
+		if err := adminSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logging.Fatalf("Failed to start admin server: %v", err)
 		}
 	}()
 
@@ -608,10 +623,11 @@ func main() {
 	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// Shutdown the server
+	// Shutdown the servers
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		logging.Fatalf("Server forced to shutdown: %v", err)
 	}
+	_ = adminSrv.Shutdown(ctx)
 
 	log.Println("Server exited properly")
 }
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/rl-sandbox/k8s-pkg/logging"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	poolLabel          = "pool"
+	poolWarm           = "warm"
+	poolClaimed        = "claimed"
+	poolSelector       = "from=control-plane,type=sandbox,pool=warm"
+	poolLockKey        = "ash:lock:pool-reconcile"
+	poolInflightKey    = "ash:pool:spawns" // ZSET of in-flight spawn IDs scored by deadline
+	poolInflightTTL    = 5 * time.Minute   // Deadline for spawns whose context has none
+	poolDemandKeyFmt   = "ash:pool:demand:%d"
+	poolCreateParallel = 5
+)
+
+// warmPool keeps pre-started sandboxes of a default image and sizes the pool
+// from recent spawn demand shared across control-plane replicas in Redis.
+type warmPool struct {
+	config    *Config
+	rdb       *redis.Client
+	clientset *kubernetes.Clientset
+	verifier  *imageVerifier
+}
+
+func newWarmPool(config *Config, rdb *redis.Client, clientset *kubernetes.Clientset, verifier *imageVerifier) *warmPool {
+	if config.WarmPoolImage == "" {
+		return nil
+	}
+	return &warmPool{config: config, rdb: rdb, clientset: clientset, verifier: verifier}
+}
+
+// eligible reports whether a spawn request can be served by a pooled sandbox
+func (p *warmPool) eligible(req *SpawnReq) bool {
+	if p == nil || req.Image != p.config.WarmPoolImage || req.Name != "" {
+		return false
+	}
+	if len(req.Env) > 0 || len(req.Labels) > 0 || req.NodeSelector != nil || req.Resources != (ResourceReq{}) ||
+		req.WorkspaceSource != "" || req.WorkspaceExport != "" || req.ExperimentID != "" || req.ReadinessCommand != "" ||
+		req.Timezone != "" || req.Locale != "" || req.DNS != nil || len(req.HostAliases) > 0 ||
+		req.Bandwidth != nil {
+		return false
+	}
+	return len(req.Ports) == 0 || (len(req.Ports) == 1 && req.Ports[0].ContainerPort == p.config.WarmPoolPort)
+}
+
+// demandKey returns the Redis counter for the demand window containing t
+func (p *warmPool) demandKey(t time.Time) string {
+	window := int64(p.config.WarmPoolWindowSec)
+	return fmt.Sprintf(poolDemandKeyFmt, t.Unix()/window)
+}
+
+// begin records a spawn request; the returned func marks it finished.
+// In-flight spawns are scored by their deadline, so the entry of a replica that
+// crashed mid-spawn ages out instead of inflating demand forever.
+func (p *warmPool) begin(ctx context.Context) func() {
+	if p == nil {
+		return func() {}
+	}
+	now := time.Now()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = now.Add(poolInflightTTL)
+	}
+	id := uuid.NewString()
+	key := p.demandKey(now)
+	pipe := p.rdb.Pipeline()
+	pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, 2*time.Duration(p.config.WarmPoolWindowSec)*time.Second)
+	pipe.ZAdd(ctx, poolInflightKey, &redis.Z{Score: float64(deadline.Unix()), Member: id})
+	if _, err := pipe.Exec(ctx); err != nil {
+		logging.Errorf("Warm pool: failed to record demand: %v", err)
+	}
+	return func() {
+		_ = p.rdb.ZRem(context.Background(), poolInflightKey, id).Err()
+	}
+}
+
+// claim takes a ready pooled sandbox, returning its name or "" if none is available.
+// Claims use optimistic concurrency so two replicas never hand out the same sandbox.
+func (p *warmPool) claim(ctx context.Context) string {
+	deps, err := p.clientset.AppsV1().Deployments(p.config.Namespace).List(ctx, metav1.ListOptions{LabelSelector: poolSelector})
+	if err != nil {
+		logging.Errorf("Warm pool: failed to list sandboxes: %v", err)
+		return ""
+	}
+	for i := range deps.Items {
+		dep := &deps.Items[i]
+		if dep.Status.AvailableReplicas < 1 {
+			continue
+		}
+		dep.Labels[poolLabel] = poolClaimed
+		if _, err := p.clientset.AppsV1().Deployments(p.config.Namespace).Update(ctx, dep, metav1.UpdateOptions{}); err != nil {
+			continue // Claimed concurrently or deleted, try the next one
+		}
+		log.Printf("Warm pool: claimed sandbox %s", dep.Name)
+		return dep.Name
+	}
+	return ""
+}
+
+// desired computes the target pool size from recent demand and in-flight spawns
+func (p *warmPool) desired(ctx context.Context) int {
+	now := time.Now()
+	window := time.Duration(p.config.WarmPoolWindowSec) * time.Second
+	pipe := p.rdb.Pipeline()
+	pipe.ZRemRangeByScore(ctx, poolInflightKey, "-inf", fmt.Sprint(now.Unix()))
+	inflight := pipe.ZCard(ctx, poolInflightKey)
+	recent := pipe.MGet(ctx, p.demandKey(now), p.demandKey(now.Add(-window)))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return p.config.WarmPoolMin
+	}
+	demand := int(inflight.Val())
+	for _, v := range recent.Val() {
+		if s, ok := v.(string); ok {
+			var n int
+			if _, err := fmt.Sscan(s, &n); err == nil && n > 0 {
+				demand += n
+			}
+		}
+	}
+	return max(p.config.WarmPoolMin, min(p.config.WarmPoolMax, demand))
+}
+
+// run reconciles the pool size until ctx is done
+func (p *warmPool) run(ctx context.Context) {
+	interval := time.Duration(p.config.WarmPoolReconcileSec) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Only one replica reconciles per interval
+		if ok, err := p.rdb.SetNX(ctx, poolLockKey, "1", interval).Result(); err == nil && ok {
+			p.reconcile(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcile creates or deletes pooled sandboxes to match the desired size
+func (p *warmPool) reconcile(ctx context.Context) {
+	deps, err := p.clientset.AppsV1().Deployments(p.config.Namespace).List(ctx, metav1.ListOptions{LabelSelector: poolSelector})
+	if err != nil {
+		logging.Errorf("Warm pool: failed to list sandboxes: %v", err)
+		return
+	}
+	target := p.desired(ctx)
+	current := len(deps.Items)
+
+	switch {
+	case current < target:
+		for i := 0; i < min(target-current, poolCreateParallel); i++ {
+			if err := p.create(ctx); err != nil {
+				logging.Errorf("Warm pool: failed to create sandbox: %v", err)
+				return
+			}
+		}
+		log.Printf("Warm pool: scaling up %d -> %d", current, target)
+	case current > target:
+		// Remove sandboxes that are not ready yet first, they are the least useful
+		surplus := current - target
+		for _, ready := range []bool{false, true} {
+			for i := range deps.Items {
+				if surplus == 0 {
+					break
+				}
+				dep := &deps.Items[i]
+				if (dep.Status.AvailableReplicas >= 1) != ready {
+					continue
+				}
+				p.remove(ctx, dep)
+				surplus--
+			}
+		}
+		log.Printf("Warm pool: scaling down %d -> %d", current, target)
+	}
+}
+
+// create starts one pooled sandbox from the pool template
+func (p *warmPool) create(ctx context.Context) error {
+	name := fmt.Sprintf("sandbox-%s", randSuffix(12))
+	labels := map[string]string{"app": name, "from": "control-plane", "type": "sandbox"}
+	req := &SpawnReq{Image: p.config.WarmPoolImage, Ports: []Port{{ContainerPort: p.config.WarmPoolPort}}}
+	if p.verifier != nil {
+		pinned, err := p.verifier.verify(ctx, req.Image)
+		if err != nil {
+			return err
+		}
+		req.Image = pinned
+	}
+
+	container, err := buildSandboxContainer(req, nil)
+	if err != nil {
+		return err
+	}
+	dep := buildSandboxDeployment(p.config, name, labels, container, nil)
+
+	// Only the Deployment carries the pool label so claiming does not roll the pod
+	depLabels := map[string]string{poolLabel: poolWarm}
+	for k, v := range labels {
+		depLabels[k] = v
+	}
+	dep.Labels = depLabels
+
+	if _, err := p.clientset.AppsV1().Deployments(p.config.Namespace).Create(ctx, dep, metav1.CreateOptions{}); err != nil {
+		return err
+	}
+	svc := buildSandboxService(p.config, name, labels, req.Ports)
+	if _, err := p.clientset.CoreV1().Services(p.config.Namespace).Create(ctx, svc, metav1.CreateOptions{}); err != nil {
+		p.remove(ctx, dep)
+		return err
+	}
+	return nil
+}
+
+// remove deletes a pooled sandbox's Service and Deployment
+func (p *warmPool) remove(ctx context.Context, dep *appsv1.Deployment) {
+	if err := p.clientset.CoreV1().Services(dep.Namespace).Delete(ctx, dep.Name, metav1.DeleteOptions{}); err != nil {
+		logging.Errorf("Warm pool: failed to delete service %s: %v", dep.Name, err)
+	}
+	if err := p.clientset.AppsV1().Deployments(dep.Namespace).Delete(ctx, dep.Name, metav1.DeleteOptions{}); err != nil {
+		logging.Errorf("Warm pool: failed to delete deployment %s: %v", dep.Name, err)
+	}
+}
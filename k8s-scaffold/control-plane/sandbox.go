@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rl-sandbox/k8s-pkg/logging"
+	"github.com/rl-sandbox/k8s-pkg/store"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// localeRe matches POSIX locale names such as C.UTF-8, en_US.UTF-8 or de_DE@euro
+var localeRe = regexp.MustCompile(`^(C|POSIX|[a-z]{2,3}(_[A-Z]{2})?)(\.[A-Za-z0-9-]+)?(@[A-Za-z0-9]+)?$`)
+
+// buildSandboxContainer builds the sandbox container from a spawn request.
+// Returned errors describe invalid client input.
+func buildSandboxContainer(req *SpawnReq, envVars []corev1.EnvVar) (corev1.Container, error) {
+	var containerPorts []corev1.ContainerPort
+	for _, p := range req.Ports {
+		containerPorts = append(containerPorts, corev1.ContainerPort{ContainerPort: int32(p.ContainerPort)})
+	}
+	if len(containerPorts) == 0 {
+		containerPorts = append(containerPorts, corev1.ContainerPort{ContainerPort: 80})
+	}
+
+	// Determine the probe port (first container port, default 3000)
+	probePort := 3000
+	if len(containerPorts) > 0 {
+		probePort = int(containerPorts[0].ContainerPort)
+	}
+
+	// Create container with readiness probe
+	// The probe checks if MCP server is listening on the port
+	container := corev1.Container{
+		Name:  "sandbox",
+		Image: req.Image,
+		Ports: containerPorts,
+		Env:   envVars,
+		ReadinessProbe: &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				TCPSocket: &corev1.TCPSocketAction{
+					Port: intstrFromInt(probePort),
+				},
+			},
+			InitialDelaySeconds: 2,
+			PeriodSeconds:       3,
+			TimeoutSeconds:      1,
+			SuccessThreshold:    1,
+			FailureThreshold:    10,
+		},
+	}
+
+	// Images whose port opens before they are usable supply their own check,
+	// run in the container by the kubelet
+	if req.ReadinessCommand != "" {
+		container.ReadinessProbe.ProbeHandler = corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{Command: []string{"sh", "-c", req.ReadinessCommand}},
+		}
+		container.ReadinessProbe.TimeoutSeconds = 5
+	}
+
+	// Clock and locale of the sandbox. Images without zoneinfo or the locale
+	// installed fall back to UTC and C.
+	if req.Timezone != "" {
+		if _, err := time.LoadLocation(req.Timezone); err != nil {
+			return container, fmt.Errorf("invalid timezone %q", req.Timezone)
+		}
+		container.Env = append(container.Env, corev1.EnvVar{Name: "TZ", Value: req.Timezone})
+	}
+	if req.Locale != "" {
+		if !localeRe.MatchString(req.Locale) {
+			return container, fmt.Errorf("invalid locale %q", req.Locale)
+		}
+		container.Env = append(container.Env,
+			corev1.EnvVar{Name: "LANG", Value: req.Locale},
+			corev1.EnvVar{Name: "LC_ALL", Value: req.Locale})
+	}
+
+	// Add resource limits and requests if specified
+	if req.Resources.Requests.CPU != "" || req.Resources.Requests.Memory != "" ||
+		req.Resources.Limits.CPU != "" || req.Resources.Limits.Memory != "" {
+
+		container.Resources = corev1.ResourceRequirements{}
+
+		if req.Resources.Requests.CPU != "" || req.Resources.Requests.Memory != "" {
+			container.Resources.Requests = corev1.ResourceList{}
+			if req.Resources.Requests.CPU != "" {
+				qty, err := resource.ParseQuantity(req.Resources.Requests.CPU)
+				if err != nil {
+					return container, fmt.Errorf("invalid CPU request: %v", err)
+				}
+				container.Resources.Requests[corev1.ResourceCPU] = qty
+			}
+			if req.Resources.Requests.Memory != "" {
+				qty, err := resource.ParseQuantity(req.Resources.Requests.Memory)
+				if err != nil {
+					return container, fmt.Errorf("invalid memory request: %v", err)
+				}
+				container.Resources.Requests[corev1.ResourceMemory] = qty
+			}
+		}
+
+		if req.Resources.Limits.CPU != "" || req.Resources.Limits.Memory != "" {
+			container.Resources.Limits = corev1.ResourceList{}
+			if req.Resources.Limits.CPU != "" {
+				qty, err := resource.ParseQuantity(req.Resources.Limits.CPU)
+				if err != nil {
+					return container, fmt.Errorf("invalid CPU limit: %v", err)
+				}
+				container.Resources.Limits[corev1.ResourceCPU] = qty
+			}
+			if req.Resources.Limits.Memory != "" {
+				qty, err := resource.ParseQuantity(req.Resources.Limits.Memory)
+				if err != nil {
+					return container, fmt.Errorf("invalid memory limit: %v", err)
+				}
+				container.Resources.Limits[corev1.ResourceMemory] = qty
+			}
+		}
+	}
+
+	return container, nil
+}
+
+// buildSandboxDeployment wraps a sandbox container in a single-replica Deployment
+func buildSandboxDeployment(config *Config, name string, labels map[string]string, container corev1.Container, nodeSelector map[string]string) *appsv1.Deployment {
+	// Use client-provided node selector, or default if not provided
+	if nodeSelector == nil {
+		nodeSelector = map[string]string{
+			"kubernetes.io/os": "linux",
+		}
+	}
+
+	podSpec := corev1.PodSpec{
+		Containers:         []corev1.Container{container},
+		ServiceAccountName: config.ServiceAccountName,
+		NodeSelector:       nodeSelector,
+	}
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: config.Namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: int32Ptr(1), // Always single replica
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": name},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec:       podSpec,
+			},
+		},
+	}
+}
+
+// buildSandboxService exposes the sandbox ports through a ClusterIP Service
+func buildSandboxService(config *Config, name string, labels map[string]string, ports []Port) *corev1.Service {
+	var servicePorts []corev1.ServicePort
+	for _, p := range ports {
+		servicePorts = append(servicePorts, corev1.ServicePort{
+			Port:       int32(p.ContainerPort),
+			TargetPort: intstrFromInt(p.ContainerPort),
+		})
+	}
+	if len(servicePorts) == 0 {
+		servicePorts = append(servicePorts, corev1.ServicePort{
+			Port:       80,
+			TargetPort: intstrFromInt(80),
+		})
+	}
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: config.Namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceTypeClusterIP,
+			Selector: map[string]string{"app": name},
+			Ports:    servicePorts,
+		},
+	}
+}
+
+// teardownSandbox deletes a sandbox's Service, links, Deployment and Redis records
+func teardownSandbox(ctx context.Context, clientset *kubernetes.Clientset, sandboxes *store.Store, namespace, name string) error {
+	if err := clientset.CoreV1().Services(namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		logging.Errorf("Failed to delete service %s/%s: %v", namespace, name, err)
+	}
+	deleteSandboxLinks(ctx, clientset, namespace, name)
+	if err := clientset.AppsV1().Deployments(namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		return fmt.Errorf("delete deployment: %w", err)
+	}
+
+	iter := sandboxes.Scan(ctx, name+"-*")
+	for iter.Next(ctx) {
+		uuid := strings.TrimPrefix(iter.Val(), sandboxes.Prefix())
+		if err := sandboxes.Delete(ctx, uuid); err != nil {
+			logging.Errorf("Failed to delete Redis key %s: %v", iter.Val(), err)
+		}
+	}
+	return iter.Err()
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rl-sandbox/k8s-pkg/logging"
+)
+
+const (
+	scanModeOff     = "off"
+	scanModeWarn    = "warn"
+	scanModeEnforce = "enforce"
+
+	scanRefKeyPrefix    = "ash:scan:ref:"
+	scanDigestKeyPrefix = "ash:scan:digest:"
+)
+
+// scanResult summarizes the vulnerabilities found in one image digest
+type scanResult struct {
+	Digest string         `json:"digest"`
+	Counts map[string]int `json:"counts"` // Severity -> number of vulnerabilities
+}
+
+// imageScanner gates spawns on a Trivy scan of the requested image. Results are
+// cached in Redis per digest; tag -> digest resolutions expire sooner so retagged
+// images are rescanned.
+type imageScanner struct {
+	config     *Config
+	rdb        *redis.Client
+	thresholds map[string]int // Severity -> max allowed count
+}
+
+func newImageScanner(config *Config, rdb *redis.Client) *imageScanner {
+	if config.ImageScanMode == scanModeOff {
+		return nil
+	}
+	thresholds, _ := parseScanThresholds(config.ImageScanThresholds)
+	return &imageScanner{config: config, rdb: rdb, thresholds: thresholds}
+}
+
+// parseScanThresholds parses "CRITICAL=0,HIGH=5" into max allowed counts per severity
+func parseScanThresholds(s string) (map[string]int, error) {
+	thresholds := map[string]int{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		sev, max, ok := strings.Cut(part, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(max))
+		if !ok || err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid threshold %q", part)
+		}
+		thresholds[strings.ToUpper(strings.TrimSpace(sev))] = n
+	}
+	return thresholds, nil
+}
+
+// enforcing reports whether violations and scan failures reject the spawn
+func (s *imageScanner) enforcing() bool {
+	return s.config.ImageScanMode == scanModeEnforce
+}
+
+// check scans image (or reuses a cached result) and returns the threshold
+// violations, if any
+func (s *imageScanner) check(ctx context.Context, image string) ([]string, error) {
+	result, err := s.cached(ctx, image)
+	if err != nil || result == nil {
+		if result, err = s.scan(ctx, image); err != nil {
+			return nil, err
+		}
+		s.store(ctx, image, result)
+	}
+
+	var violations []string
+	for sev, max := range s.thresholds {
+		if n := result.Counts[sev]; n > max {
+			violations = append(violations, fmt.Sprintf("%d %s (max %d)", n, sev, max))
+		}
+	}
+	sort.Strings(violations)
+	return violations, nil
+}
+
+// cached returns the stored result for image, or nil if it must be scanned
+func (s *imageScanner) cached(ctx context.Context, image string) (*scanResult, error) {
+	digest := imageDigest(image)
+	if digest == "" {
+		var err error
+		if digest, err = s.rdb.Get(ctx, scanRefKeyPrefix+image).Result(); err != nil {
+			return nil, err
+		}
+	}
+	data, err := s.rdb.Get(ctx, scanDigestKeyPrefix+digest).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	var result scanResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (s *imageScanner) store(ctx context.Context, image string, result *scanResult) {
+	if result.Digest == "" {
+		return
+	}
+	data, _ := json.Marshal(result)
+	pipe := s.rdb.Pipeline()
+	pipe.Set(ctx, scanDigestKeyPrefix+result.Digest, data, time.Duration(s.config.ImageScanCacheSec)*time.Second)
+	if imageDigest(image) == "" {
+		pipe.Set(ctx, scanRefKeyPrefix+image, result.Digest, time.Duration(s.config.ImageScanTagCacheSec)*time.Second)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		logging.Errorf("Failed to cache scan result for %s: %v", image, err)
+	}
+}
+
+// scan runs the Trivy client against the configured Trivy server
+func (s *imageScanner) scan(ctx context.Context, image string) (*scanResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(s.config.ImageScanTimeoutSec)*time.Second)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "trivy", "image",
+		"--server", s.config.ImageScanServer,
+		"--scanners", "vuln",
+		"--cache-dir", "/tmp/trivy",
+		"--format", "json",
+		"--quiet",
+		"--", image)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("trivy scan of %s failed: %v: %s", image, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var report struct {
+		Metadata struct {
+			ImageID     string   `json:"ImageID"`
+			RepoDigests []string `json:"RepoDigests"`
+		} `json:"Metadata"`
+		Results []struct {
+			Vulnerabilities []struct {
+				Severity string `json:"Severity"`
+			} `json:"Vulnerabilities"`
+		} `json:"Results"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		return nil, fmt.Errorf("decode trivy report for %s: %w", image, err)
+	}
+
+	result := &scanResult{Digest: report.Metadata.ImageID, Counts: map[string]int{}}
+	for _, d := range report.Metadata.RepoDigests {
+		if digest := imageDigest(d); digest != "" {
+			result.Digest = digest
+			break
+		}
+	}
+	for _, r := range report.Results {
+		for _, v := range r.Vulnerabilities {
+			result.Counts[strings.ToUpper(v.Severity)]++
+		}
+	}
+	return result, nil
+}
+
+// imageDigest returns the sha256 digest pinned in an image reference, or ""
+func imageDigest(image string) string {
+	if _, digest, ok := strings.Cut(image, "@"); ok {
+		return digest
+	}
+	return ""
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseScanThresholds(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]int
+		wantErr bool
+	}{
+		{"", map[string]int{}, false},
+		{"CRITICAL=0,HIGH=5", map[string]int{"CRITICAL": 0, "HIGH": 5}, false},
+		{" critical = 0 , high=5 ,", map[string]int{"CRITICAL": 0, "HIGH": 5}, false},
+		{"CRITICAL", nil, true},
+		{"CRITICAL=many", nil, true},
+		{"HIGH=-1", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseScanThresholds(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseScanThresholds(%q) error = %v, wantErr %t", tt.in, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseScanThresholds(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageDigest(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"python:3.12", ""},
+		{"registry.example.com:5000/team/app", ""},
+		{"ghcr.io/org/app@sha256:abc123", "sha256:abc123"},
+		{"ghcr.io/org/app:1.2@sha256:abc123", "sha256:abc123"},
+	}
+	for _, tt := range tests {
+		if got := imageDigest(tt.image); got != tt.want {
+			t.Errorf("imageDigest(%q) = %q, want %q", tt.image, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/rl-sandbox/k8s-pkg/ash"
+	"github.com/rl-sandbox/k8s-pkg/logging"
+)
+
+const (
+	shardMembersKey = "ash:shards"     // Sorted set of live instance IDs scored by lease expiry
+	shardURLsKey    = "ash:shard-urls" // Hash of instance ID -> advertised URL
+	shardHeader     = "X-Ash-Shard-Forwarded"
+)
+
+// shardPoint is one virtual node on the hash ring
+type shardPoint struct {
+	hash uint32
+	id   string
+}
+
+// shardRing assigns UUIDs (and fleet names) to control-plane instances by
+// consistent hashing over the membership registered in Redis. A nil ring
+// owns everything, which is the unsharded single-owner behaviour.
+type shardRing struct {
+	config *Config
+	rdb    *redis.Client
+
+	mu     sync.RWMutex
+	points []shardPoint
+	urls   map[string]string
+}
+
+// newShardRing returns nil unless SHARDING is enabled
+func newShardRing(config *Config, rdb *redis.Client) *shardRing {
+	if !config.Sharding {
+		return nil
+	}
+	return &shardRing{config: config, rdb: rdb}
+}
+
+func shardHash(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// refresh renews this instance's lease, drops expired members and rebuilds the ring
+func (s *shardRing) refresh(ctx context.Context) error {
+	ttl := time.Duration(s.config.ShardLeaseSec) * time.Second
+	now := time.Now()
+
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, shardMembersKey, &redis.Z{Score: float64(now.Add(ttl).Unix()), Member: s.config.ShardID})
+		pipe.HSet(ctx, shardURLsKey, s.config.ShardID, s.config.ShardURL)
+		pipe.ZRemRangeByScore(ctx, shardMembersKey, "-inf", "("+strconv.FormatInt(now.Unix(), 10))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	ids, err := s.rdb.ZRange(ctx, shardMembersKey, 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	urls := map[string]string{}
+	if len(ids) > 0 {
+		vals, err := s.rdb.HMGet(ctx, shardURLsKey, ids...).Result()
+		if err != nil {
+			return err
+		}
+		for i, v := range vals {
+			if u, ok := v.(string); ok {
+				urls[ids[i]] = u
+			}
+		}
+	}
+
+	points := make([]shardPoint, 0, len(urls)*s.config.ShardVnodes)
+	for id := range urls {
+		for i := 0; i < s.config.ShardVnodes; i++ {
+			points = append(points, shardPoint{hash: shardHash(fmt.Sprintf("%s#%d", id, i)), id: id})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].hash < points[j].hash })
+
+	s.mu.Lock()
+	changed := len(s.urls) != len(urls)
+	s.points, s.urls = points, urls
+	s.mu.Unlock()
+	if changed {
+		log.Printf("Shard ring now has %d members", len(urls))
+	}
+	return nil
+}
+
+// run keeps the lease and ring fresh until ctx is done, then leaves the ring
+func (s *shardRing) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(s.config.ShardLeaseSec) * time.Second / 3)
+	defer ticker.Stop()
+
+	for {
+		if err := s.refresh(ctx); err != nil && ctx.Err() == nil {
+			logging.Errorf("Shard ring refresh failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			leaveCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			s.rdb.ZRem(leaveCtx, shardMembersKey, s.config.ShardID)
+			s.rdb.HDel(leaveCtx, shardURLsKey, s.config.ShardID)
+			cancel()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// owner returns the instance ID and URL owning key, empty if the ring is empty
+func (s *shardRing) owner(key string) (string, string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.points) == 0 {
+		return "", ""
+	}
+	h := shardHash(key)
+	i := sort.Search(len(s.points), func(i int) bool { return s.points[i].hash >= h })
+	if i == len(s.points) {
+		i = 0
+	}
+	id := s.points[i].id
+	return id, s.urls[id]
+}
+
+// owns reports whether this instance is responsible for key. Until the ring is
+// populated every instance owns everything, so nothing is dropped at startup.
+func (s *shardRing) owns(key string) bool {
+	if s == nil {
+		return true
+	}
+	id, _ := s.owner(key)
+	return id == "" || id == s.config.ShardID
+}
+
+// forwardToOwner proxies requests for a :uuid owned by another instance to it.
+// Forwarded requests are always served locally so a stale ring cannot loop.
+func (s *shardRing) forwardToOwner(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s == nil || c.GetHeader(shardHeader) != "" {
+			c.Next()
+			return
+		}
+		id, ownerURL := s.owner(c.Param(param))
+		if id == "" || id == s.config.ShardID {
+			c.Next()
+			return
+		}
+		target, err := url.Parse(ownerURL)
+		if err != nil {
+			logging.Warnf("Shard %s has invalid URL %q, serving locally", id, ownerURL)
+			c.Next()
+			return
+		}
+
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			logging.Errorf("Forwarding %s %s to shard %s failed: %v", r.Method, r.URL.Path, id, err)
+			respondError(c, http.StatusBadGateway, ash.CodeShardUnavailable, "Failed to reach owning control-plane instance")
+		}
+		c.Request.Header.Set(shardHeader, s.config.ShardID)
+		logger("shard").Debug("forwarding request to owner", "method", c.Request.Method, "path", c.Request.URL.Path, "shard", id)
+		proxy.ServeHTTP(c.Writer, c.Request)
+		c.Abort()
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rl-sandbox/k8s-pkg/ash"
+	"github.com/rl-sandbox/k8s-pkg/backoff"
+	"github.com/rl-sandbox/k8s-pkg/logging"
+	"github.com/rl-sandbox/k8s-pkg/store"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Spawn failure stages, reported as failure_stage so orchestrators can decide
+// whether to retry, change the image or alert
+const (
+	stageImageVerify      = "image_verify"
+	stageImageScan        = "image_scan"
+	stageDeploymentCreate = "deployment_create"
+	stageServiceCreate    = "service_create"
+	stageImagePull        = "image_pull"
+	stageProbeTimeout     = "probe_timeout"
+)
+
+// imagePullReasons are container waiting reasons that mean the image cannot be pulled
+var imagePullReasons = map[string]bool{
+	"ErrImagePull":      true,
+	"ImagePullBackOff":  true,
+	"InvalidImageName":  true,
+	"ErrImageNeverPull": true,
+}
+
+// imagePullError reports that a sandbox's image cannot be pulled
+type imagePullError struct {
+	reason  string
+	message string
+}
+
+func (e *imagePullError) Error() string { return e.reason + ": " + e.message }
+
+// checkImagePull returns an imagePullError if a pod of the sandbox is stuck pulling its image
+func (sp *spawner) checkImagePull(ctx context.Context, name string) error {
+	pods, err := sp.clientset.CoreV1().Pods(sp.config.Namespace).List(ctx, metav1.ListOptions{LabelSelector: "app=" + name})
+	if err != nil {
+		return nil
+	}
+	for _, pod := range pods.Items {
+		statuses := append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...)
+		for _, cs := range statuses {
+			if w := cs.State.Waiting; w != nil && imagePullReasons[w.Reason] {
+				return &imagePullError{reason: w.Reason, message: w.Message}
+			}
+		}
+	}
+	return nil
+}
+
+var errDeploymentNotReady = errors.New("deployment not ready")
+
+// redisRetryPolicy is used for short Redis writes that should survive a brief blip
+var redisRetryPolicy = backoff.Policy{
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     1 * time.Second,
+	Jitter:         0.5,
+	MaxAttempts:    3,
+}
+
+// spawner creates sandboxes; it backs POST /spawn and the fleet reconciler
+type spawner struct {
+	config    *Config
+	clientset *kubernetes.Clientset
+	sandboxes *store.Store
+	pool      *warmPool
+	scanner   *imageScanner
+	verifier  *imageVerifier
+}
+
+// spawn creates a sandbox for req. On failure it returns the HTTP status and error to report.
+func (sp *spawner) spawn(ctx context.Context, req SpawnReq) (*SpawnResp, int, *ash.Error) {
+	// Only run images signed by a trusted key or identity, pinned to the signed digest
+	pinnedImage := req.Image
+	if sp.verifier != nil {
+		pinned, err := sp.verifier.verify(ctx, req.Image)
+		if err != nil {
+			logging.Errorf("Image signature verification failed: %v", err)
+			return nil, http.StatusForbidden, newAPIError(ash.CodeImageRejected, fmt.Sprintf("Image %s has no trusted signature", req.Image))
+		}
+		pinnedImage = pinned
+	}
+
+	// Reject or flag images over the vulnerability thresholds
+	var warnings []string
+	if sp.scanner != nil {
+		violations, err := sp.scanner.check(ctx, pinnedImage)
+		switch {
+		case err != nil && sp.scanner.enforcing():
+			logging.Errorf("Image scan failed for %s: %v", req.Image, err)
+			return nil, http.StatusServiceUnavailable, newAPIError(ash.CodeImageScanFailed, "Image scan failed").AtStage(stageImageScan)
+		case err != nil:
+			logging.Warnf("Image scan failed for %s, allowing: %v", req.Image, err)
+			warnings = append(warnings, "image scan failed")
+		case len(violations) > 0 && sp.scanner.enforcing():
+			return nil, http.StatusForbidden, newAPIError(ash.CodeImageRejected,
+				fmt.Sprintf("Image %s exceeds vulnerability thresholds: %s", req.Image, strings.Join(violations, ", "))).AtStage(stageImageScan)
+		case len(violations) > 0:
+			logging.Warnf("Image %s exceeds vulnerability thresholds: %s", req.Image, strings.Join(violations, ", "))
+			warnings = append(warnings, "vulnerabilities above threshold: "+strings.Join(violations, ", "))
+		}
+	}
+
+	// Track demand so the warm pool can scale ahead of bursts
+	done := sp.pool.begin(ctx)
+	defer done()
+
+	name := req.Name
+
+	// Serve from the warm pool when the request matches its template.
+	// Pooled sandboxes start before their UUID exists, so they get no heartbeat env.
+	claimed := false
+	if sp.pool.eligible(&req) {
+		if pooled := sp.pool.claim(ctx); pooled != "" {
+			name, claimed = pooled, true
+		}
+	}
+
+	if name == "" {
+		name = fmt.Sprintf("sandbox-%s", randSuffix(12))
+	}
+	labels := map[string]string{"app": name, "from": "control-plane", "type": "sandbox"}
+	if req.ExperimentID != "" {
+		if errs := validation.IsValidLabelValue(req.ExperimentID); len(errs) > 0 {
+			return nil, http.StatusBadRequest, newAPIError(ash.CodeInvalidRequest, fmt.Sprintf("invalid experiment_id: %s", strings.Join(errs, "; ")))
+		}
+		labels[experimentLabel] = req.ExperimentID
+	}
+	for k, v := range req.Labels {
+		if errs := append(validation.IsQualifiedName(k), validation.IsValidLabelValue(v)...); len(errs) > 0 {
+			return nil, http.StatusBadRequest, newAPIError(ash.CodeInvalidRequest, fmt.Sprintf("invalid label %q: %s", k, strings.Join(errs, "; ")))
+		}
+		// Reserved labels drive selectors and cleanup, never let clients override them
+		if _, reserved := labels[k]; !reserved {
+			labels[k] = v
+		}
+	}
+
+	sandboxUUID := fmt.Sprintf("%s-%s", name, uuid.New().String())
+	var heartbeatToken string
+
+	ready := true
+	var failureStage, message string
+	var retryable bool
+	var svcObj *corev1.Service
+	if !claimed {
+		// 1) Deployment
+		var envVars []corev1.EnvVar
+		for k, v := range req.Env {
+			envVars = append(envVars, corev1.EnvVar{Name: k, Value: v})
+		}
+		heartbeatToken = newHeartbeatToken(sp.config)
+		envVars = append(envVars, heartbeatEnv(sp.config, sandboxUUID, heartbeatToken)...)
+
+		spec := req
+		spec.Image = pinnedImage
+		container, err := buildSandboxContainer(&spec, envVars)
+		if err != nil {
+			return nil, http.StatusBadRequest, newAPIError(ash.CodeInvalidRequest, err.Error())
+		}
+		dep := buildSandboxDeployment(sp.config, name, labels, container, req.NodeSelector)
+		if err := addWorkspace(sp.config, &req, dep); err != nil {
+			return nil, http.StatusBadRequest, newAPIError(ash.CodeInvalidRequest, err.Error())
+		}
+		if err := addDNS(&req, dep); err != nil {
+			return nil, http.StatusBadRequest, newAPIError(ash.CodeInvalidRequest, err.Error())
+		}
+		if err := addBandwidth(&req, dep); err != nil {
+			return nil, http.StatusBadRequest, newAPIError(ash.CodeInvalidRequest, err.Error())
+		}
+
+		// Create deployment with context
+		_, err = sp.clientset.AppsV1().Deployments(sp.config.Namespace).Create(ctx, dep, metav1.CreateOptions{})
+		if err != nil {
+			logging.Errorf("Failed to create deployment: %v", err)
+			apiErr := newAPIError(ash.CodeKubernetesError, fmt.Sprintf("Failed to create deployment: %v", err)).AtStage(stageDeploymentCreate)
+			apiErr.Retryable = kubeRetryable(err)
+			return nil, http.StatusInternalServerError, apiErr
+		}
+
+		// 2) Create ClusterIP Service
+		svc := buildSandboxService(sp.config, name, labels, req.Ports)
+		svcObj, err = sp.clientset.CoreV1().Services(sp.config.Namespace).Create(ctx, svc, metav1.CreateOptions{})
+		if err != nil {
+			apiErr := newAPIError(ash.CodeKubernetesError, fmt.Sprintf("Failed to create service: %v", err)).AtStage(stageServiceCreate)
+			apiErr.Retryable = kubeRetryable(err)
+			return nil, http.StatusInternalServerError, apiErr
+		}
+
+		// 3) Wait for Deployment Ready with exponential backoff
+		waitPolicy := backoff.Policy{
+			InitialBackoff: 1 * time.Second,
+			MaxBackoff:     10 * time.Second,
+			Jitter:         0.5,
+			MaxElapsed:     time.Duration(sp.config.WaitDeployReadySec) * time.Second,
+		}
+		waitErr := backoff.Retry(ctx, waitPolicy, func(ctx context.Context) error {
+			cur, err := sp.clientset.AppsV1().Deployments(sp.config.Namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if cur.Status.AvailableReplicas < 1 {
+				// An unpullable image never becomes ready, stop waiting for it
+				if err := sp.checkImagePull(ctx, name); err != nil {
+					return backoff.Permanent(err)
+				}
+				return errDeploymentNotReady
+			}
+			return nil
+		})
+		ready = waitErr == nil
+
+		// An unpullable image will not recover, so remove the sandbox rather than hand it out
+		var pullErr *imagePullError
+		if errors.As(waitErr, &pullErr) {
+			logging.Warnf("Sandbox %s image cannot be pulled, tearing it down: %v", name, pullErr)
+			teardownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			if err := teardownSandbox(teardownCtx, sp.clientset, sp.sandboxes, sp.config.Namespace, name); err != nil {
+				logging.Errorf("Failed to tear down sandbox %s: %v", name, err)
+			}
+			cancel()
+			return nil, http.StatusUnprocessableEntity, newAPIError(ash.CodeImagePullFailed,
+				fmt.Sprintf("Image %s cannot be pulled: %s", req.Image, pullErr)).AtStage(stageImagePull)
+		}
+		if waitErr != nil {
+			failureStage, retryable = stageProbeTimeout, true
+			message = fmt.Sprintf("Sandbox not ready after %ds", sp.config.WaitDeployReadySec)
+		}
+	}
+
+	// 4) Collect Service Address (ClusterIP only)
+	var clusterIP string
+	var svcPorts []int
+	if svcObj != nil || claimed {
+		s, err := sp.clientset.CoreV1().Services(sp.config.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if err == nil {
+			clusterIP = s.Spec.ClusterIP
+			for _, p := range s.Spec.Ports {
+				svcPorts = append(svcPorts, int(p.Port))
+			}
+		}
+	}
+
+	// Prepare Redis record
+	sandboxStatus := store.StatusReady
+	if !ready {
+		sandboxStatus = store.StatusStarting
+	}
+
+	sandboxPort := 0
+	if len(svcPorts) > 0 {
+		sandboxPort = svcPorts[0]
+	}
+
+	// Record metadata shared with other components
+	now := time.Now().UTC()
+	ttl := time.Duration(sp.config.SandboxTTLSec) * time.Second
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = now.Add(ttl)
+	}
+
+	record := &store.Record{
+		UUID:      sandboxUUID,
+		Host:      fmt.Sprintf("%s.%s.svc.cluster.local", name, sp.config.Namespace),
+		Port:      sandboxPort,
+		Status:    sandboxStatus,
+		Image:     req.Image,
+		Owner:     req.Owner,
+		Labels:    req.Labels,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: expiresAt,
+
+		ExperimentID:   req.ExperimentID,
+		HeartbeatToken: heartbeatToken,
+	}
+	err := backoff.Retry(ctx, redisRetryPolicy, func(ctx context.Context) error {
+		return sp.sandboxes.Put(ctx, record, ttl)
+	})
+	if err != nil {
+		logging.Errorf("Failed to save sandbox record to Redis: %v", err)
+	}
+
+	log.Printf("Sandbox created: name=%s, uuid=%s, status=%s", name, sandboxUUID, sandboxStatus)
+
+	resp := SpawnResp{
+		Name:        name,
+		UUID:        sandboxUUID,
+		Namespace:   sp.config.Namespace,
+		Status:      cases.Title(language.English).String(sandboxStatus),
+		ServiceType: "ClusterIP",
+		ClusterIP:   clusterIP,
+		Host:        fmt.Sprintf("%s.%s.svc.cluster.local", name, sp.config.Namespace),
+		Ports:       svcPorts,
+		Image:       req.Image,
+		Owner:       req.Owner,
+		Labels:      req.Labels,
+		CreatedAt:   now.Format(time.RFC3339),
+		Warnings:    warnings,
+		Message:     message,
+
+		FailureStage: failureStage,
+		Retryable:    retryable,
+		ExperimentID: req.ExperimentID,
+	}
+	if !expiresAt.IsZero() {
+		resp.ExpiresAt = expiresAt.Format(time.RFC3339)
+	}
+
+	// Log status
+	status := "success"
+	if !ready {
+		status = "partial"
+	}
+	log.Printf("Spawn request completed with status: %s", status)
+	if failureStage != "" {
+		logging.Warnf("Sandbox %s failed at %s: %s", name, failureStage, message)
+	}
+	return &resp, http.StatusOK, nil
+}
+
+// kubeRetryable reports whether a failed Kubernetes write may succeed when repeated.
+// Forbidden counts as retryable since it is also how exhausted quotas are reported.
+func kubeRetryable(err error) bool {
+	return !apierrors.IsInvalid(err) && !apierrors.IsAlreadyExists(err) && !apierrors.IsBadRequest(err)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/rl-sandbox/k8s-pkg/logging"
+)
+
+const verifyKeyPrefix = "ash:verify:"
+
+// imageVerifier admits only images signed by a configured public key or keyless
+// identity, using the cosign CLI. Verified references resolve to a digest which
+// callers pin in the Deployment, so the tag cannot move between check and pull.
+type imageVerifier struct {
+	config *Config
+	rdb    *redis.Client
+	keys   []string
+}
+
+func newImageVerifier(config *Config, rdb *redis.Client) *imageVerifier {
+	if !config.ImageVerify {
+		return nil
+	}
+	var keys []string
+	for _, k := range strings.Split(config.ImageVerifyKeys, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return &imageVerifier{config: config, rdb: rdb, keys: keys}
+}
+
+// verify checks the signature of image and returns it pinned to the signed digest
+func (v *imageVerifier) verify(ctx context.Context, image string) (string, error) {
+	if digest, err := v.rdb.Get(ctx, verifyKeyPrefix+image).Result(); err == nil {
+		return pinImage(image, digest), nil
+	}
+
+	var attempts [][]string
+	for _, key := range v.keys {
+		attempts = append(attempts, []string{"--key", key})
+	}
+	if v.config.ImageVerifyIdentity != "" {
+		attempts = append(attempts, []string{
+			"--certificate-identity-regexp", v.config.ImageVerifyIdentity,
+			"--certificate-oidc-issuer", v.config.ImageVerifyIssuer,
+		})
+	}
+
+	var errs []error
+	for _, args := range attempts {
+		digest, err := v.cosignVerify(ctx, image, args)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ttl := time.Duration(v.config.ImageVerifyCacheSec) * time.Second
+		if err := v.rdb.Set(ctx, verifyKeyPrefix+image, digest, ttl).Err(); err != nil {
+			logging.Errorf("Failed to cache signature verification for %s: %v", image, err)
+		}
+		return pinImage(image, digest), nil
+	}
+	return "", fmt.Errorf("no trusted signature for %s: %w", image, errors.Join(errs...))
+}
+
+// cosignVerify runs one cosign verification and returns the signed manifest digest
+func (v *imageVerifier) cosignVerify(ctx context.Context, image string, args []string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(v.config.ImageVerifyTimeoutSec)*time.Second)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmdArgs := append([]string{"verify", "--output", "json"}, args...)
+	cmd := exec.CommandContext(ctx, "cosign", append(cmdArgs, "--", image)...)
+	cmd.Env = append(os.Environ(), "TUF_ROOT=/tmp/sigstore")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("cosign verify: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var payloads []struct {
+		Critical struct {
+			Image struct {
+				Digest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+		} `json:"critical"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &payloads); err != nil {
+		return "", fmt.Errorf("decode cosign output: %w", err)
+	}
+	for _, p := range payloads {
+		if p.Critical.Image.Digest != "" {
+			return p.Critical.Image.Digest, nil
+		}
+	}
+	return "", errors.New("cosign output has no signed digest")
+}
+
+// pinImage replaces the tag or digest of an image reference with digest
+func pinImage(image, digest string) string {
+	repo, _, _ := strings.Cut(image, "@")
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo = repo[:i]
+	}
+	return repo + "@" + digest
+}
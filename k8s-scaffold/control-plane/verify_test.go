@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestPinImage(t *testing.T) {
+	const digest = "sha256:abc123"
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"python", "python@" + digest},
+		{"python:3.12", "python@" + digest},
+		{"ghcr.io/org/app:1.2", "ghcr.io/org/app@" + digest},
+		{"ghcr.io/org/app@sha256:old", "ghcr.io/org/app@" + digest},
+		{"ghcr.io/org/app:1.2@sha256:old", "ghcr.io/org/app@" + digest},
+		{"registry.example.com:5000/team/app", "registry.example.com:5000/team/app@" + digest},
+		{"registry.example.com:5000/team/app:v2", "registry.example.com:5000/team/app@" + digest},
+	}
+	for _, tt := range tests {
+		if got := pinImage(tt.image, digest); got != tt.want {
+			t.Errorf("pinImage(%q) = %q, want %q", tt.image, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	workspaceVolume    = "workspace"
+	workspaceSyncMount = "/workspace"
+)
+
+// Scripts run in the sync image; the object-store location is passed via
+// WORKSPACE_REMOTE so client input never reaches the shell unquoted.
+const (
+	workspaceSeedScript = `set -e
+rclone copyto "$WORKSPACE_REMOTE" /tmp/workspace.tar.gz
+tar -xzf /tmp/workspace.tar.gz -C ` + workspaceSyncMount
+
+	workspaceExportScript = `export_workspace() {
+  tar -czf /tmp/workspace.tar.gz -C ` + workspaceSyncMount + ` . && rclone copyto /tmp/workspace.tar.gz "$WORKSPACE_REMOTE"
+  exit
+}
+trap export_workspace TERM
+sleep 2147483647 & wait $!`
+)
+
+// workspaceRemote converts an s3:// or gs:// URI to an rclone remote path that
+// authenticates from the environment (credentials secret or workload identity)
+func workspaceRemote(uri string) (string, error) {
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok || rest == "" || strings.HasPrefix(rest, "/") {
+		return "", fmt.Errorf("invalid workspace URI %q", uri)
+	}
+	switch scheme {
+	case "s3":
+		return ":s3,env_auth=true:" + rest, nil
+	case "gs", "gcs":
+		return ":gcs,env_auth=true:" + rest, nil
+	default:
+		return "", fmt.Errorf("unsupported workspace URI scheme %q (want s3 or gs)", scheme)
+	}
+}
+
+// addWorkspace wires workspace seeding and export into a sandbox Deployment.
+// The workspace is an emptyDir mounted at WorkspaceDir in the sandbox. An init
+// container unpacks workspace_source (a .tar.gz) into it before the sandbox starts,
+// so the sandbox cannot become ready without its workspace. A sidecar packs and
+// uploads it to workspace_export when the pod is terminated at deprovision.
+func addWorkspace(config *Config, req *SpawnReq, dep *appsv1.Deployment) error {
+	if req.WorkspaceSource == "" && req.WorkspaceExport == "" {
+		return nil
+	}
+
+	dir := req.WorkspaceDir
+	if dir == "" {
+		dir = config.WorkspaceDir
+	}
+	if !path.IsAbs(dir) {
+		return fmt.Errorf("workspace_dir must be an absolute path")
+	}
+
+	spec := &dep.Spec.Template.Spec
+	spec.Volumes = append(spec.Volumes, corev1.Volume{
+		Name:         workspaceVolume,
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+	spec.Containers[0].VolumeMounts = append(spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+		Name:      workspaceVolume,
+		MountPath: dir,
+	})
+
+	syncContainer := func(name, uri, script string) (corev1.Container, error) {
+		remote, err := workspaceRemote(uri)
+		if err != nil {
+			return corev1.Container{}, err
+		}
+		container := corev1.Container{
+			Name:         name,
+			Image:        config.WorkspaceSyncImage,
+			Command:      []string{"sh", "-c", script},
+			Env:          []corev1.EnvVar{{Name: "WORKSPACE_REMOTE", Value: remote}},
+			VolumeMounts: []corev1.VolumeMount{{Name: workspaceVolume, MountPath: workspaceSyncMount}},
+		}
+		if config.WorkspaceCredentialsSecret != "" {
+			container.EnvFrom = []corev1.EnvFromSource{{
+				SecretRef: &corev1.SecretEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: config.WorkspaceCredentialsSecret},
+				},
+			}}
+		}
+		return container, nil
+	}
+
+	if req.WorkspaceSource != "" {
+		seed, err := syncContainer("workspace-seed", req.WorkspaceSource, workspaceSeedScript)
+		if err != nil {
+			return err
+		}
+		spec.InitContainers = append(spec.InitContainers, seed)
+	}
+
+	if req.WorkspaceExport != "" {
+		export, err := syncContainer("workspace-export", req.WorkspaceExport, workspaceExportScript)
+		if err != nil {
+			return err
+		}
+		spec.Containers = append(spec.Containers, export)
+
+		// Give the sidecar time to upload before the pod is killed
+		grace := int64(config.WorkspaceExportGraceSec)
+		spec.TerminationGracePeriodSeconds = &grace
+	}
+	return nil
+}
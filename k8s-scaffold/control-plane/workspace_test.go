@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestWorkspaceRemote(t *testing.T) {
+	remotes := map[string]string{
+		"s3://bucket/runs/ws.tar.gz": ":s3,env_auth=true:bucket/runs/ws.tar.gz",
+		"gs://bucket/ws.tar.gz":      ":gcs,env_auth=true:bucket/ws.tar.gz",
+		"gcs://bucket/ws.tar.gz":     ":gcs,env_auth=true:bucket/ws.tar.gz",
+	}
+	for uri, want := range remotes {
+		if got, err := workspaceRemote(uri); err != nil || got != want {
+			t.Errorf("workspaceRemote(%q) = %q, %v, want %q", uri, got, err, want)
+		}
+	}
+
+	// Only object store URIs with a bucket and a relative object path are accepted
+	for _, uri := range []string{"https://bucket/ws.tar.gz", "bucket/ws.tar.gz", "s3://", "s3:///etc/passwd"} {
+		if got, err := workspaceRemote(uri); err == nil {
+			t.Errorf("workspaceRemote(%q) = %q, want an error", uri, got)
+		}
+	}
+}
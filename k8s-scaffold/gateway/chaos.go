@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/rl-sandbox/k8s-pkg/ash"
+	"github.com/rl-sandbox/k8s-pkg/chaos"
+	"github.com/rl-sandbox/k8s-pkg/logging"
+)
+
+// Fault injection for resilience testing. Only mounted when CHAOS_ENABLED is set;
+// rules are managed through /admin/chaos on the admin listener and shared by all
+// replicas via Redis.
+
+const chaosKey = "ash:chaos:gateway"
+
+// activeChaos holds the current rules, refreshed from Redis
+var activeChaos atomic.Pointer[[]chaos.Rule]
+
+// loadChaosRules reads the rules from Redis into activeChaos
+func loadChaosRules(ctx context.Context) error {
+	rules, err := chaos.Load(ctx, rdb, chaosKey)
+	if err != nil {
+		return err
+	}
+	activeChaos.Store(&rules)
+	return nil
+}
+
+// runChaosRefresh keeps activeChaos in sync with Redis until ctx is done
+func runChaosRefresh(ctx context.Context) {
+	ticker := time.NewTicker(chaos.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		if err := loadChaosRules(ctx); err != nil && ctx.Err() == nil {
+			logging.Errorf("[chaos] failed to load rules: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// chaosMiddleware applies the first matching rule that fires to each request
+func chaosMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Probes stay healthy so faults cannot get replicas killed
+		rules := activeChaos.Load()
+		if rules == nil || r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rule := chaos.Pick(*rules, r)
+		if rule == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		debugf("chaos", "[chaos] injecting into %s %s: latency=%dms status=%d drop=%t",
+			r.Method, r.URL.Path, rule.LatencyMs, rule.Status, rule.Drop)
+		if rule.LatencyMs > 0 {
+			select {
+			case <-time.After(time.Duration(rule.LatencyMs) * time.Millisecond):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if rule.Drop {
+			if hj, ok := w.(http.Hijacker); ok {
+				if conn, _, err := hj.Hijack(); err == nil {
+					conn.Close()
+					return
+				}
+			}
+			panic(http.ErrAbortHandler)
+		}
+		if rule.Status != 0 {
+			w.Header().Set(chaos.Header, "true")
+			code := ash.CodeUpstreamError
+			if rule.Status == http.StatusGatewayTimeout {
+				code = ash.CodeUpstreamTimeout
+			}
+			writeError(w, rule.Status, code, "injected failure")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleChaosAdmin shows (GET), replaces (PUT) or clears (DELETE) the fault rules
+func handleChaosAdmin(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	switch r.Method {
+	case http.MethodGet:
+		rules := activeChaos.Load()
+		if rules == nil {
+			rules = &[]chaos.Rule{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"rules": *rules})
+	case http.MethodPut:
+		var rules []chaos.Rule
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&rules); err != nil {
+			writeError(w, http.StatusBadRequest, ash.CodeInvalidRequest, "invalid rules: "+err.Error())
+			return
+		}
+		if err := chaos.Validate(rules); err != nil {
+			writeError(w, http.StatusBadRequest, ash.CodeInvalidRequest, err.Error())
+			return
+		}
+		if err := chaos.Store(ctx, rdb, chaosKey, rules); err != nil {
+			writeError(w, http.StatusBadGateway, ash.CodeRouteLookupError, "failed to store rules")
+			return
+		}
+		activeChaos.Store(&rules)
+		log.Printf("[chaos] %d rules installed", len(rules))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"rules": rules})
+	case http.MethodDelete:
+		if err := rdb.Del(ctx, chaosKey).Err(); err != nil {
+			writeError(w, http.StatusBadGateway, ash.CodeRouteLookupError, "failed to clear rules")
+			return
+		}
+		activeChaos.Store(&[]chaos.Rule{})
+		log.Printf("[chaos] rules cleared")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, ash.CodeMethodNotAllowed, "method not allowed")
+	}
+}
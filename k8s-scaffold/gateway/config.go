@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rl-sandbox/k8s-pkg/settings"
+)
+
+// validate rejects configurations that would misbehave at runtime
+func (c *Config) validate() error {
+	var errs []string
+	if c.ListenAddr == "" {
+		errs = append(errs, "LISTEN_ADDR must not be empty")
+	}
+	if c.AdminAddr == "" || c.AdminAddr == c.ListenAddr {
+		errs = append(errs, "ADMIN_ADDR must be set and differ from LISTEN_ADDR")
+	}
+	if c.SessionHeader == "" {
+		errs = append(errs, "SESSION_HEADER must not be empty")
+	}
+	if c.DefaultScheme != "http" && c.DefaultScheme != "https" {
+		errs = append(errs, "DEFAULT_SCHEME must be http or https")
+	}
+	if c.RedisLookupTimeout <= 0 {
+		errs = append(errs, "REDIS_LOOKUP_TIMEOUT must be positive")
+	}
+	if c.RequestTimeout <= 0 {
+		errs = append(errs, "REQUEST_TIMEOUT must be positive")
+	}
+	if c.WriteTimeout > 0 && c.WriteTimeout < c.RequestTimeout {
+		errs = append(errs, "WRITE_TIMEOUT must be >= REQUEST_TIMEOUT")
+	}
+	if c.MCPAutoProvision && !json.Valid([]byte(c.MCPSpawnTemplate)) {
+		errs = append(errs, "MCP_SPAWN_TEMPLATE must be valid JSON")
+	}
+	if c.MCPAutoProvision && c.MCPAutoProvisionMax < 1 {
+		errs = append(errs, "MCP_AUTO_PROVISION_MAX must be >= 1")
+	}
+	if c.TransformMaxBodyBytes < 0 {
+		errs = append(errs, "TRANSFORM_MAX_BODY_BYTES must be >= 0")
+	}
+	if c.UpstreamRetryAttempts < 1 {
+		errs = append(errs, "UPSTREAM_RETRY_ATTEMPTS must be >= 1")
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// handleConfigz shows the effective configuration with secrets masked
+func handleConfigz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(settings.Effective(config))
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// dnsCache caches upstream host resolutions so busy sandboxes do not cost a
+// cluster-DNS lookup per new connection. Entries are re-resolved after the TTL
+// or as soon as dialing every cached address fails.
+type dnsCache struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]dnsEntry
+	inflight  map[string]*dnsCall
+	nextSweep time.Time // Expired entries are dropped on the first insert after this
+
+	hits    atomic.Int64
+	misses  atomic.Int64
+	refresh atomic.Int64 // Re-resolutions forced by dial failures
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+// dnsCall is a lookup in progress that concurrent misses wait on
+type dnsCall struct {
+	done  chan struct{}
+	addrs []string
+	err   error
+}
+
+var upstreamDNS *dnsCache
+
+func newDNSCache(ttl time.Duration) *dnsCache {
+	return &dnsCache{
+		ttl:      ttl,
+		entries:  make(map[string]dnsEntry),
+		inflight: make(map[string]*dnsCall),
+	}
+}
+
+// lookup returns the addresses of host, resolving at most once at a time per host
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]string, bool, error) {
+	c.mu.Lock()
+	if e, ok := c.entries[host]; ok && time.Now().Before(e.expires) {
+		c.mu.Unlock()
+		c.hits.Add(1)
+		return e.addrs, true, nil
+	}
+	call, ok := c.inflight[host]
+	if !ok {
+		call = &dnsCall{done: make(chan struct{})}
+		c.inflight[host] = call
+	}
+	c.mu.Unlock()
+	c.misses.Add(1)
+
+	if ok {
+		select {
+		case <-call.done:
+			return call.addrs, false, call.err
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+
+	// Not bound to ctx so one cancelled request cannot fail the lookup for its waiters
+	lookupCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	call.addrs, call.err = net.DefaultResolver.LookupHost(lookupCtx, host)
+	cancel()
+	if call.err == nil && len(call.addrs) == 0 {
+		call.err = &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+	}
+
+	c.mu.Lock()
+	delete(c.inflight, host)
+	if call.err == nil {
+		c.put(host, call.addrs, time.Now())
+	}
+	c.mu.Unlock()
+	close(call.done)
+	return call.addrs, false, call.err
+}
+
+// put caches addrs for host, sweeping expired entries at most once per TTL so
+// sandboxes that are gone do not pin their hosts forever. Callers hold c.mu.
+func (c *dnsCache) put(host string, addrs []string, now time.Time) {
+	if !now.Before(c.nextSweep) {
+		for h, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, h)
+			}
+		}
+		c.nextSweep = now.Add(c.ttl)
+	}
+	c.entries[host] = dnsEntry{addrs: addrs, expires: now.Add(c.ttl)}
+}
+
+func (c *dnsCache) invalidate(host string) {
+	c.mu.Lock()
+	delete(c.entries, host)
+	c.mu.Unlock()
+}
+
+// dial connects to addr through the cache, re-resolving once if every cached address fails
+func (c *dnsCache) dial(ctx context.Context, dialer *net.Dialer, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	var dialErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		addrs, cached, err := c.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range addrs {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			dialErr = err
+		}
+		if !cached || ctx.Err() != nil {
+			break
+		}
+		debugf("dns", "[dns] dial to cached %s failed, re-resolving: %v", host, dialErr)
+		c.invalidate(host)
+		c.refresh.Add(1)
+	}
+	return nil, dialErr
+}
+
+// dialUpstream dials an upstream address, through the DNS cache when enabled
+func dialUpstream(ctx context.Context, dialer *net.Dialer, network, addr string) (net.Conn, error) {
+	if upstreamDNS == nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	return upstreamDNS.dial(ctx, dialer, network, addr)
+}
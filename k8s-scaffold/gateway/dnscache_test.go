@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDNSCacheSweepsExpiredEntries(t *testing.T) {
+	c := newDNSCache(time.Minute)
+	start := time.Now()
+
+	c.put("a.sandbox", []string{"10.0.0.1"}, start)
+	c.put("b.sandbox", []string{"10.0.0.2"}, start.Add(30*time.Second))
+
+	// No sweep is due before start+1m, when a expires
+	c.put("c.sandbox", []string{"10.0.0.3"}, start.Add(59*time.Second))
+	if len(c.entries) != 3 {
+		t.Fatalf("entries before sweep = %d, want 3", len(c.entries))
+	}
+
+	c.put("d.sandbox", []string{"10.0.0.4"}, start.Add(61*time.Second))
+	if _, ok := c.entries["a.sandbox"]; ok {
+		t.Error("expired a.sandbox survived the sweep")
+	}
+	for _, host := range []string{"b.sandbox", "c.sandbox", "d.sandbox"} {
+		if _, ok := c.entries[host]; !ok {
+			t.Errorf("live entry %s was swept", host)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rl-sandbox/k8s-pkg/store"
+)
+
+// routingDomain is one class of routable backends sharing a Redis key prefix,
+// e.g. sandboxes under sandbox: and tool servers under tool:
+type routingDomain struct {
+	Name        string `json:"name"`
+	KeyPrefix   string `json:"key_prefix"`
+	Scheme      string `json:"scheme"`       // Upstream scheme, default DEFAULT_SCHEME
+	DefaultPort int    `json:"default_port"` // Port used when a record has none, default store.DefaultPort
+	BasePath    string `json:"base_path"`    // Upstream base path, default /mcp
+	PathPrefix  string `json:"path_prefix"`  // Requests under this path select the domain, stripped before proxying
+
+	routes *store.Store
+}
+
+var (
+	domains       []*routingDomain
+	defaultDomain *routingDomain
+)
+
+// setupRoutingDomains builds the default domain from ROUTE_KEY_PREFIX plus any
+// extra domains declared as a JSON list in ROUTING_DOMAINS
+func setupRoutingDomains(c *Config) error {
+	defaultDomain = &routingDomain{
+		Name:      "default",
+		KeyPrefix: c.RedisKeyPrefix,
+		Scheme:    c.DefaultScheme,
+		BasePath:  "/mcp",
+		routes:    routes,
+	}
+	domains = []*routingDomain{defaultDomain}
+	if c.RoutingDomains == "" {
+		return nil
+	}
+
+	var extra []*routingDomain
+	if err := json.Unmarshal([]byte(c.RoutingDomains), &extra); err != nil {
+		return fmt.Errorf("parse ROUTING_DOMAINS: %w", err)
+	}
+	seen := map[string]bool{defaultDomain.Name: true}
+	for _, d := range extra {
+		switch {
+		case d.Name == "" || d.KeyPrefix == "":
+			return fmt.Errorf("ROUTING_DOMAINS: every domain needs a name and key_prefix")
+		case seen[d.Name]:
+			return fmt.Errorf("ROUTING_DOMAINS: duplicate domain %q", d.Name)
+		case d.PathPrefix != "" && !strings.HasPrefix(d.PathPrefix, "/"):
+			return fmt.Errorf("ROUTING_DOMAINS: path_prefix of %q must start with /", d.Name)
+		}
+		seen[d.Name] = true
+		if d.Scheme == "" {
+			d.Scheme = c.DefaultScheme
+		}
+		if d.Scheme != "http" && d.Scheme != "https" {
+			return fmt.Errorf("ROUTING_DOMAINS: scheme of %q must be http or https", d.Name)
+		}
+		if d.BasePath == "" {
+			d.BasePath = "/mcp"
+		}
+		d.PathPrefix = strings.TrimRight(d.PathPrefix, "/")
+		d.routes = store.New(rdb, d.KeyPrefix)
+		domains = append(domains, d)
+	}
+	return nil
+}
+
+// selectDomain picks the routing domain of a request: the domain named in the
+// ROUTING_DOMAIN_HEADER header, else the first whose path_prefix matches (which
+// is stripped from the request path), else the default domain
+func selectDomain(r *http.Request) (*routingDomain, bool) {
+	if name := strings.TrimSpace(r.Header.Get(config.RoutingDomainHeader)); name != "" {
+		for _, d := range domains {
+			if d.Name == name {
+				return d, true
+			}
+		}
+		return nil, false
+	}
+	for _, d := range domains {
+		if d.PathPrefix == "" {
+			continue
+		}
+		if r.URL.Path == d.PathPrefix || strings.HasPrefix(r.URL.Path, d.PathPrefix+"/") {
+			r.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, d.PathPrefix), "/")
+			r.URL.RawPath = ""
+			return d, true
+		}
+	}
+	return defaultDomain, true
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSelectDomain(t *testing.T) {
+	withConfig(t, &Config{RoutingDomainHeader: "X-Sandbox-Domain"})
+	withDomains(t,
+		&routingDomain{Name: "default"},
+		&routingDomain{Name: "tools", PathPrefix: "/tools"},
+		&routingDomain{Name: "envs"},
+	)
+
+	tests := []struct {
+		name     string
+		path     string
+		header   string
+		want     string // Empty = no domain selected
+		wantPath string
+	}{
+		{"default", "/mcp", "", "default", "/mcp"},
+		{"header", "/mcp", "envs", "envs", "/mcp"},
+		{"header wins over path", "/tools/mcp", "envs", "envs", "/tools/mcp"},
+		{"unknown header", "/mcp", "nope", "", "/mcp"},
+		{"path prefix stripped", "/tools/mcp", "", "tools", "/mcp"},
+		{"exact path prefix", "/tools", "", "tools", "/"},
+		{"prefix needs a path boundary", "/toolsmith/mcp", "", "default", "/toolsmith/mcp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			if tt.header != "" {
+				r.Header.Set(config.RoutingDomainHeader, tt.header)
+			}
+			d, ok := selectDomain(r)
+			switch {
+			case tt.want == "" && ok:
+				t.Fatalf("selectDomain selected %q, want none", d.Name)
+			case tt.want != "" && (!ok || d.Name != tt.want):
+				t.Fatalf("selectDomain = %v, %t, want %q", d, ok, tt.want)
+			}
+			if r.URL.Path != tt.wantPath {
+				t.Errorf("path = %q, want %q", r.URL.Path, tt.wantPath)
+			}
+		})
+	}
+}
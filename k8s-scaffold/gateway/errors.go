@@ -0,0 +1,21 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rl-sandbox/k8s-pkg/ash"
+)
+
+// newAPIError builds a gateway error, deriving the retryable flag from the code
+func newAPIError(code, message string) *ash.Error {
+	return ash.NewError("gateway", code, message)
+}
+
+// writeError writes a structured JSON error response
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(newAPIError(code, message))
+}
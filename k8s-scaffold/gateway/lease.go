@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rl-sandbox/k8s-pkg/logging"
+)
+
+// leaseRenewer extends the TTL of routed session keys on traffic, at most once per interval per UUID
+type leaseRenewer struct {
+	mu      sync.Mutex
+	renewed map[string]time.Time
+}
+
+var leases = &leaseRenewer{renewed: make(map[string]time.Time)}
+
+// touch refreshes the key's TTL in the background if renewal is enabled and due.
+// Keys without a TTL are left untouched.
+func (l *leaseRenewer) touch(d *routingDomain, uuid string) {
+	if config.LeaseRenewTTL <= 0 {
+		return
+	}
+
+	key := d.KeyPrefix + uuid
+	now := time.Now()
+	l.mu.Lock()
+	if last, ok := l.renewed[key]; ok && now.Sub(last) < config.LeaseRenewInterval {
+		l.mu.Unlock()
+		return
+	}
+	l.renewed[key] = now
+	if len(l.renewed) > 10000 {
+		for k, t := range l.renewed {
+			if now.Sub(t) >= config.LeaseRenewInterval {
+				delete(l.renewed, k)
+			}
+		}
+	}
+	l.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), config.RedisLookupTimeout)
+		defer cancel()
+
+		if err := d.routes.Touch(ctx, uuid, config.LeaseRenewTTL); err != nil {
+			logging.Errorf("[lease] renew failed for %s: %v", uuid, err)
+		}
+	}()
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// logger returns a named sub-logger for a gateway component
+func logger(component string) *slog.Logger {
+	return slog.Default().With("component", component)
+}
+
+// debugf logs a formatted debug message for component, skipping formatting when disabled
+func debugf(component, format string, args ...interface{}) {
+	l := slog.Default()
+	if !l.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+	l.Debug(fmt.Sprintf(format, args...), "component", component)
+}
@@ -7,21 +7,27 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/http/httputil"
 	"net/url"
 	"os"
 	"os/signal"
-	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/rl-sandbox/k8s-pkg/ash"
+	"github.com/rl-sandbox/k8s-pkg/backoff"
+	"github.com/rl-sandbox/k8s-pkg/chaos"
+	"github.com/rl-sandbox/k8s-pkg/logging"
+	"github.com/rl-sandbox/k8s-pkg/settings"
+	"github.com/rl-sandbox/k8s-pkg/store"
 )
 
 // Common errors
 var (
-	ErrNotFound = errors.New("not found")
+	ErrNotFound = store.ErrNotFound
 )
 
 // Configuration structure
@@ -29,7 +35,7 @@ type Config struct {
 	ListenAddr         string        // Listen address, default :80
 	SessionHeader      string        // Request header to get UUID from, default X-Session-ID
 	RedisAddr          string        // Redis address, default 127.0.0.1:6379
-	RedisPassword      string        // Redis password, optional
+	RedisPassword      string        `secret:"true"` // Redis password, optional
 	RedisDB            int           // Redis database, default 0
 	RedisKeyPrefix     string        // Route table key prefix, default sandbox:
 	DefaultScheme      string        // Protocol to use when only host:port is given, default http
@@ -38,6 +44,42 @@ type Config struct {
 	ReadTimeout        time.Duration // HTTP server read timeout
 	WriteTimeout       time.Duration // HTTP server write timeout
 	IdleTimeout        time.Duration // HTTP server idle timeout
+
+	ControlPlaneURL     string        // Control-plane base URL used by POST /sessions
+	DefaultSandboxImage string        // Image spawned when POST /sessions has no body
+	SessionSpawnTimeout time.Duration // Max time to spawn and wait for a session sandbox, default 5 minutes
+	MCPAutoProvision    bool          // Spawn a sandbox for MCP initialize requests without a session header
+	MCPSpawnTemplate    string        // Spawn payload (JSON) for auto-provisioned MCP sessions, default {"image": DEFAULT_SANDBOX_IMAGE}
+	MCPAutoProvisionMax int           // Auto-provisions running at once across all clients (one per client), default 4
+
+	UpstreamMaxIdleConns          int           // Max idle upstream connections across all hosts, default 256
+	UpstreamMaxIdleConnsPerHost   int           // Max idle upstream connections per sandbox, default 128
+	UpstreamMaxConnsPerHost       int           // Max total upstream connections per sandbox, 0 = unlimited
+	UpstreamIdleConnTimeout       time.Duration // How long idle upstream connections are kept, default 90s
+	UpstreamDialTimeout           time.Duration // Upstream TCP dial timeout, default 30s
+	UpstreamDNSCacheTTL           time.Duration // How long resolved upstream hosts are reused, 0 = resolve every dial, default 30s
+	UpstreamResponseHeaderTimeout time.Duration // Max wait for upstream response headers, default 4 minutes
+	UpstreamTLSCAFile             string        // PEM CA bundle for https upstreams, optional
+	UpstreamTLSInsecure           bool          // Skip upstream TLS verification, default false
+
+	RoutingDomains      string // JSON list of extra routing domains (name, key_prefix, scheme, default_port, base_path, path_prefix)
+	RoutingDomainHeader string // Request header naming the routing domain, default X-Sandbox-Domain
+
+	TunnelAllowedPorts []int // Sandbox ports reachable via /tunnel, empty = the sandbox service port only
+
+	ReplayBufferBytes     int64         // Request bodies up to this size are buffered for retries, default 64KiB
+	UpstreamRetryAttempts int           // Total attempts for requests failing to reach the upstream, default 1 (no retry)
+	UpstreamRetryBackoff  time.Duration // Backoff before the first retry, doubling per attempt, default 200ms
+
+	LeaseRenewTTL      time.Duration // TTL to extend session keys to on traffic, 0 = disabled
+	LeaseRenewInterval time.Duration // Minimum time between renewals of the same key, default 30s
+
+	ChaosEnabled bool // Mount the /admin/chaos fault injection API (admin listener) and middleware, test clusters only
+
+	TransformRulesFile    string // YAML file of request/response transformation rules, optional
+	TransformMaxBodyBytes int64  // Bodies up to this size may be rewritten by rules, default 1MiB
+
+	AdminAddr string // Listen address for operator endpoints (/configz, /metrics, /admin/chaos), kept off the proxied port, default :9090
 }
 
 // SandboxRecord represents a sandbox record in Redis
@@ -48,56 +90,100 @@ type SandboxRecord struct {
 	Status string
 }
 
-// Helper functions for environment variables
-func getenv(key, def string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
-	}
-	return def
-}
-
-func getenvInt(key string, def int) int {
-	if v := os.Getenv(key); v != "" {
-		if n, err := strconv.Atoi(v); err == nil {
-			return n
-		}
-	}
-	return def
-}
-
-func getenvDur(key string, def time.Duration) time.Duration {
-	if v := os.Getenv(key); v != "" {
-		if d, err := time.ParseDuration(v); err == nil {
-			return d
-		}
-	}
-	return def
-}
-
-// Load configuration from environment variables
+// Load configuration from the config file, environment variables and flags
 func loadConfig() *Config {
-	return &Config{
-		ListenAddr:         getenv("LISTEN_ADDR", ":8080"),
-		SessionHeader:      getenv("SESSION_HEADER", "X-Session-ID"),
-		RedisAddr:          getenv("REDIS_ADDR", "127.0.0.1:6379"),
-		RedisPassword:      os.Getenv("REDIS_PASSWORD"),
-		RedisDB:            getenvInt("REDIS_DB", 0),
-		RedisKeyPrefix:     getenv("ROUTE_KEY_PREFIX", "sandbox:"),
-		DefaultScheme:      getenv("DEFAULT_SCHEME", "http"),
-		RedisLookupTimeout: getenvDur("REDIS_LOOKUP_TIMEOUT", 300*time.Millisecond),
-		RequestTimeout:     getenvDur("REQUEST_TIMEOUT", 3*time.Minute),
-		ReadTimeout:        getenvDur("READ_TIMEOUT", 4*time.Minute),
-		WriteTimeout:       getenvDur("WRITE_TIMEOUT", 4*time.Minute),
-		IdleTimeout:        getenvDur("IDLE_TIMEOUT", 2*time.Minute),
+	c := &Config{
+		ListenAddr:         settings.String("LISTEN_ADDR", ":8080"),
+		SessionHeader:      settings.String("SESSION_HEADER", "X-Session-ID"),
+		RedisAddr:          settings.String("REDIS_ADDR", "127.0.0.1:6379"),
+		RedisPassword:      settings.String("REDIS_PASSWORD", ""),
+		RedisDB:            settings.Int("REDIS_DB", 0),
+		RedisKeyPrefix:     settings.String("ROUTE_KEY_PREFIX", "sandbox:"),
+		DefaultScheme:      settings.String("DEFAULT_SCHEME", "http"),
+		RedisLookupTimeout: settings.Duration("REDIS_LOOKUP_TIMEOUT", 300*time.Millisecond),
+		RequestTimeout:     settings.Duration("REQUEST_TIMEOUT", 3*time.Minute),
+		ReadTimeout:        settings.Duration("READ_TIMEOUT", 4*time.Minute),
+		WriteTimeout:       settings.Duration("WRITE_TIMEOUT", 4*time.Minute),
+		IdleTimeout:        settings.Duration("IDLE_TIMEOUT", 2*time.Minute),
+
+		ControlPlaneURL:     settings.String("CONTROL_PLANE_URL", "http://control-plane.ash.svc.cluster.local"),
+		DefaultSandboxImage: settings.String("DEFAULT_SANDBOX_IMAGE", "timemagic/rl-mcp:general-1.7"),
+		SessionSpawnTimeout: settings.Duration("SESSION_SPAWN_TIMEOUT", 5*time.Minute),
+		MCPAutoProvision:    settings.Bool("MCP_AUTO_PROVISION", false),
+		MCPSpawnTemplate:    settings.String("MCP_SPAWN_TEMPLATE", ""),
+		MCPAutoProvisionMax: settings.Int("MCP_AUTO_PROVISION_MAX", 4),
+
+		UpstreamMaxIdleConns:          settings.Int("UPSTREAM_MAX_IDLE_CONNS", 256),
+		UpstreamMaxIdleConnsPerHost:   settings.Int("UPSTREAM_MAX_IDLE_CONNS_PER_HOST", 128),
+		UpstreamMaxConnsPerHost:       settings.Int("UPSTREAM_MAX_CONNS_PER_HOST", 0),
+		UpstreamIdleConnTimeout:       settings.Duration("UPSTREAM_IDLE_CONN_TIMEOUT", 90*time.Second),
+		UpstreamDialTimeout:           settings.Duration("UPSTREAM_DIAL_TIMEOUT", 30*time.Second),
+		UpstreamDNSCacheTTL:           settings.Duration("UPSTREAM_DNS_CACHE_TTL", 30*time.Second),
+		UpstreamResponseHeaderTimeout: settings.Duration("UPSTREAM_RESPONSE_HEADER_TIMEOUT", 4*time.Minute),
+		UpstreamTLSCAFile:             settings.String("UPSTREAM_TLS_CA_FILE", ""),
+		UpstreamTLSInsecure:           settings.Bool("UPSTREAM_TLS_INSECURE_SKIP_VERIFY", false),
+
+		RoutingDomains:      settings.String("ROUTING_DOMAINS", ""),
+		RoutingDomainHeader: settings.String("ROUTING_DOMAIN_HEADER", "X-Sandbox-Domain"),
+
+		TunnelAllowedPorts: settings.IntList("TUNNEL_ALLOWED_PORTS"),
+
+		ReplayBufferBytes:     int64(settings.Int("REPLAY_BUFFER_BYTES", 64<<10)),
+		UpstreamRetryAttempts: settings.Int("UPSTREAM_RETRY_ATTEMPTS", 1),
+		UpstreamRetryBackoff:  settings.Duration("UPSTREAM_RETRY_BACKOFF", 200*time.Millisecond),
+
+		LeaseRenewTTL:      settings.Duration("LEASE_RENEW_TTL", 0),
+		LeaseRenewInterval: settings.Duration("LEASE_RENEW_INTERVAL", 30*time.Second),
+
+		ChaosEnabled: settings.Bool("CHAOS_ENABLED", false),
+
+		TransformRulesFile:    settings.String("TRANSFORM_RULES_FILE", ""),
+		TransformMaxBodyBytes: int64(settings.Int("TRANSFORM_MAX_BODY_BYTES", 1<<20)),
+
+		AdminAddr: settings.String("ADMIN_ADDR", ":9090"),
 	}
+	if c.MCPSpawnTemplate == "" {
+		c.MCPSpawnTemplate = fmt.Sprintf(`{"image":%q}`, c.DefaultSandboxImage)
+	}
+	return c
 }
 
 var (
 	rdb       *redis.Client
+	routes    *store.Store
 	config    *Config
 	targetKey = &struct{}{} // context key for storing target URL
 )
 
+// restartedHeader is set on the first response after a sandbox was replaced
+const restartedHeader = "X-Sandbox-Restarted"
+
+// restartKey marks proxied requests whose sandbox has an unannounced restart
+var restartKey = &struct{}{}
+
+// pendingRestart identifies the route whose restart flag a response may claim
+type pendingRestart struct {
+	routes *store.Store
+	uuid   string
+}
+
+// announceRestart clears a pending restart flag and sets restartedHeader once a
+// successful response is about to reach the client. Failed responses leave the
+// flag set, so the client still learns of the restart on its next request.
+func announceRestart(resp *http.Response) {
+	pending, _ := resp.Request.Context().Value(restartKey).(*pendingRestart)
+	if pending == nil || resp.StatusCode >= 400 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(resp.Request.Context(), config.RedisLookupTimeout)
+	defer cancel()
+	if claimed, err := pending.routes.ClaimRestart(ctx, pending.uuid); err != nil {
+		logging.Errorf("[redis] restart claim error: %v", err)
+	} else if claimed {
+		resp.Header.Set(restartedHeader, "true")
+	}
+}
+
 // Get client IP from request
 
 func clientIP(r *http.Request) string {
@@ -112,49 +198,44 @@ func clientIP(r *http.Request) string {
 	return h
 }
 
-// Look up target URL from Redis based on UUID
-func lookupTarget(ctx context.Context, uuid string) (*url.URL, error) {
-	key := config.RedisKeyPrefix + uuid
-
-	// Use Redis pipeline for efficiency
-	pipe := rdb.Pipeline()
-	getHostCmd := pipe.HGet(ctx, key, "host")
-	getPortCmd := pipe.HGet(ctx, key, "port")
-
-	// Execute pipeline
-	_, err := pipe.Exec(ctx)
-	if err != nil && err != redis.Nil {
-		return nil, fmt.Errorf("redis pipeline error: %w", err)
+// Look up target URL from Redis based on UUID, also reporting an unannounced restart
+func lookupTarget(ctx context.Context, d *routingDomain, uuid string) (*url.URL, bool, error) {
+	route, err := d.routes.Route(ctx, uuid)
+	if err != nil {
+		return nil, false, err
 	}
-
-	// Get host
-	host, err := getHostCmd.Result()
-	if err == redis.Nil || host == "" {
-		return nil, ErrNotFound
+	port := route.Port
+	if port == 0 {
+		port = d.DefaultPort
 	}
-
-	// Get port
-	portStr, err := getPortCmd.Result()
-	if err == redis.Nil || portStr == "" {
-		// Default to port 3000 if not specified
-		portStr = "3000"
+	if port == 0 {
+		port = store.DefaultPort
 	}
 
-	port, err := strconv.Atoi(portStr)
-	if err != nil {
-		return nil, fmt.Errorf("invalid port %q: %w", portStr, err)
-	}
-
-	log.Printf("[lookup] UUID %s -> Host %s, Port %d", uuid, host, port)
-	return url.Parse(fmt.Sprintf("%s://%s:%d/mcp", config.DefaultScheme, host, port))
+	log.Printf("[lookup] UUID %s -> Host %s, Port %d (domain %s)", uuid, route.Host, port, d.Name)
+	u, err := url.Parse(fmt.Sprintf("%s://%s:%d%s", d.Scheme, route.Host, port, d.BasePath))
+	return u, route.RestartPending, err
 }
 
 func main() {
 	// Load configuration
+	if err := settings.Load(); err != nil {
+		log.Fatalf("config error: %v", err)
+	}
+	logging.Setup("gateway")
 	config = loadConfig()
+	if err := config.validate(); err != nil {
+		logging.Fatalf("%v", err)
+	}
 	log.Printf("[config] listen=%s sessionHeader=%s redis=%s db=%d prefix=%s defaultScheme=%s",
 		config.ListenAddr, config.SessionHeader, config.RedisAddr, config.RedisDB,
 		config.RedisKeyPrefix, config.DefaultScheme)
+	if err := loadTransformRules(config.TransformRulesFile); err != nil {
+		logging.Fatalf("%v", err)
+	}
+	if len(transformRules) > 0 {
+		log.Printf("[config] transform rules=%d file=%s", len(transformRules), config.TransformRulesFile)
+	}
 
 	// Initialize Redis client
 	rdb = redis.NewClient(&redis.Options{
@@ -168,22 +249,29 @@ func main() {
 		MinIdleConns: 5,
 	})
 
+	routes = store.New(rdb, config.RedisKeyPrefix)
+	if err := setupRoutingDomains(config); err != nil {
+		logging.Fatalf("%v", err)
+	}
+	if len(domains) > 1 {
+		log.Printf("[config] routing domains=%d header=%s", len(domains), config.RoutingDomainHeader)
+	}
+
 	// Test Redis connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := rdb.Ping(ctx).Err(); err != nil {
-		log.Fatalf("redis ping failed: %v", err)
+		logging.Fatalf("redis ping failed: %v", err)
 	}
 
 	// Configure transport for reverse proxy
-	transport := http.DefaultTransport.(*http.Transport).Clone()
-	transport.Proxy = http.ProxyFromEnvironment
-	transport.MaxIdleConns = 256
-	transport.MaxIdleConnsPerHost = 128
-	transport.IdleConnTimeout = 90 * time.Second
-	transport.TLSHandshakeTimeout = 10 * time.Second
-	transport.ExpectContinueTimeout = 1 * time.Second
-	transport.ResponseHeaderTimeout = 4 * time.Minute // Allow upstream to process before responding
+	transport, err := newUpstreamTransport(config)
+	if err != nil {
+		logging.Fatalf("upstream transport config error: %v", err)
+	}
+	log.Printf("[config] upstream maxIdle=%d maxIdlePerHost=%d maxConnsPerHost=%d idleTimeout=%s",
+		config.UpstreamMaxIdleConns, config.UpstreamMaxIdleConnsPerHost,
+		config.UpstreamMaxConnsPerHost, config.UpstreamIdleConnTimeout)
 
 	// Create reverse proxy
 	proxy := &httputil.ReverseProxy{
@@ -201,10 +289,8 @@ func main() {
 			origQuery := r.URL.RawQuery
 			xffBefore := r.Header.Get("X-Forwarded-For")
 
-			if os.Getenv("DEBUG") == "true" {
-				log.Printf("[director][before] method=%s origHost=%s path=%q rawQuery=%q xff=%q target=%s",
-					r.Method, origHost, origPath, origQuery, xffBefore, u.String())
-			}
+			debugf("director", "[director][before] method=%s origHost=%s path=%q rawQuery=%q xff=%q target=%s",
+				r.Method, origHost, origPath, origQuery, xffBefore, u.String())
 
 			// Set scheme and host
 			r.URL.Scheme = u.Scheme
@@ -230,52 +316,65 @@ func main() {
 			r.Header.Set("X-Forwarded-Host", origHost)
 			r.Header.Set("X-Forwarded-Proto", "http") // Adjust if using HTTPS
 
-			if os.Getenv("DEBUG") == "true" {
-				log.Printf("[director][after] forwardTo=%s path=%q xff=%q",
-					u.String(), r.URL.Path, r.Header.Get("X-Forwarded-For"))
-			}
+			debugf("director", "[director][after] forwardTo=%s path=%q xff=%q",
+				u.String(), r.URL.Path, r.Header.Get("X-Forwarded-For"))
 		},
 
-		Transport:     transport,
+		Transport: &retryTransport{
+			base: transport,
+			policy: backoff.Policy{
+				InitialBackoff: config.UpstreamRetryBackoff,
+				MaxBackoff:     8 * config.UpstreamRetryBackoff,
+				Jitter:         0.2,
+				MaxAttempts:    config.UpstreamRetryAttempts,
+			},
+		},
 		FlushInterval: 50 * time.Millisecond,
 
-		// Log response status
+		// Log response status, announce restarts and apply response transformation rules
 		ModifyResponse: func(resp *http.Response) error {
-			if resp.StatusCode >= 400 || os.Getenv("DEBUG") == "true" {
+			if resp.StatusCode >= 400 {
 				log.Printf("[proxy][resp] status=%d url=%s", resp.StatusCode, resp.Request.URL.String())
+			} else {
+				debugf("proxy", "[proxy][resp] status=%d url=%s", resp.StatusCode, resp.Request.URL.String())
 			}
-			return nil
+			announceRestart(resp)
+			return transformResponse(resp)
 		},
 
 		// Handle errors
 		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
 			u, _ := r.Context().Value(targetKey).(*url.URL)
 			if u != nil {
-				log.Printf("[proxy][error] upstream error: %v target=%s method=%s path=%q",
+				logging.Errorf("[proxy][error] upstream error: %v target=%s method=%s path=%q",
 					err, u.String(), r.Method, r.URL.Path)
 			} else {
-				log.Printf("[proxy][error] upstream error: %v (no target) method=%s path=%q",
+				logging.Errorf("[proxy][error] upstream error: %v (no target) method=%s path=%q",
 					err, r.Method, r.URL.Path)
 			}
 
 			// Return appropriate error based on the type
 			if errors.Is(err, context.DeadlineExceeded) {
-				http.Error(w, "gateway timeout", http.StatusGatewayTimeout)
+				writeError(w, http.StatusGatewayTimeout, ash.CodeUpstreamTimeout, "gateway timeout")
 			} else {
-				http.Error(w, "bad gateway", http.StatusBadGateway)
+				writeError(w, http.StatusBadGateway, ash.CodeUpstreamError, "bad gateway")
 			}
 		},
 	}
 
-	// Create HTTP mux
+	// Create HTTP muxes: mux serves clients and proxies every unmatched path to
+	// sandboxes, adminMux serves operators on a port that is not exposed publicly
 	mux := http.NewServeMux()
+	adminMux := http.NewServeMux()
 
 	// Health check endpoint
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+	healthz := func(w http.ResponseWriter, _ *http.Request) {
 		w.Header().Set("Content-Type", "text/plain")
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
-	})
+	}
+	mux.HandleFunc("/healthz", healthz)
+	adminMux.HandleFunc("/healthz", healthz)
 
 	// Readiness check endpoint
 	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
@@ -294,12 +393,45 @@ func main() {
 		_, _ = w.Write([]byte("ready"))
 	})
 
+	// Effective configuration (secrets redacted)
+	adminMux.HandleFunc("/configz", handleConfigz)
+
+	// Connection pool metrics
+	adminMux.HandleFunc("/metrics", handleMetrics)
+
+	// Session bootstrap endpoint: spawn a sandbox and return its session ID
+	mux.HandleFunc("/sessions", handleCreateSession)
+
+	// Raw TCP tunnel to a sandbox port
+	mux.HandleFunc("/tunnel/{uuid}/{port}", handleTunnel)
+
+	// Fault injection for resilience tests, never enable in production
+	var handler http.Handler = mux
+	if config.ChaosEnabled {
+		adminMux.HandleFunc(chaos.AdminPath, handleChaosAdmin)
+		handler = chaosMiddleware(mux)
+		chaosCtx, stopChaos := context.WithCancel(context.Background())
+		defer stopChaos()
+		go runChaosRefresh(chaosCtx)
+		log.Printf("[config] chaos fault injection enabled, rules at %s on the admin listener", chaos.AdminPath)
+	}
+
 	// Main handler for proxying requests
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		// Get UUID from header
 		uuid := strings.TrimSpace(r.Header.Get(config.SessionHeader))
+		if uuid == "" && config.MCPAutoProvision && isMCPInitialize(r) {
+			if uuid = autoProvisionMCP(w, r); uuid == "" {
+				return
+			}
+		}
 		if uuid == "" {
-			http.Error(w, "missing session header", http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, ash.CodeInvalidRequest, "missing session header")
+			return
+		}
+		domain, ok := selectDomain(r)
+		if !ok {
+			writeError(w, http.StatusBadRequest, ash.CodeInvalidRequest, "unknown routing domain")
 			return
 		}
 
@@ -307,45 +439,75 @@ func main() {
 		lookupCtx, lookupCancel := context.WithTimeout(r.Context(), config.RedisLookupTimeout)
 		defer lookupCancel()
 
-		u, err := lookupTarget(lookupCtx, uuid)
+		u, restartPending, err := lookupTarget(lookupCtx, domain, uuid)
 		if err != nil {
 			if errors.Is(err, ErrNotFound) {
 				log.Printf("[gateway] UUID not found: %s", uuid)
-				http.Error(w, "route not found", http.StatusNotFound)
+				writeError(w, http.StatusNotFound, ash.CodeNotFound, "route not found")
 				return
 			}
-			log.Printf("[redis] lookup error: %v", err)
-			http.Error(w, "route lookup error", http.StatusBadGateway)
+			logging.Errorf("[redis] lookup error: %v", err)
+			writeError(w, http.StatusBadGateway, ash.CodeRouteLookupError, "route lookup error")
 			return
 		}
 
+		// Keep the session key alive while it is being used
+		leases.touch(domain, uuid)
+
+		// Buffer small bodies so failed upstream attempts can be replayed
+		if config.UpstreamRetryAttempts > 1 {
+			if err := bufferRequestBody(r, config.ReplayBufferBytes); err != nil {
+				writeError(w, http.StatusBadRequest, ash.CodeInvalidRequest, "failed to read request body")
+				return
+			}
+		}
+
 		// Create request context with timeout - cancels upstream request after timeout
 		reqCtx, reqCancel := context.WithTimeout(r.Context(), config.RequestTimeout)
 		defer reqCancel()
 
 		// Add target URL to context and proxy the request
 		reqCtx = context.WithValue(reqCtx, targetKey, u)
-		if os.Getenv("DEBUG") == "true" {
-			log.Printf("[gateway] routing request: method=%s path=%q target=%s timeout=%s", r.Method, r.URL.Path, u.String(), config.RequestTimeout)
+		if restartPending {
+			// Tell the client once that its sandbox was replaced so it can resync state
+			reqCtx = context.WithValue(reqCtx, restartKey, &pendingRestart{routes: domain.routes, uuid: uuid})
+		}
+		if reqCtx, err = transformRequest(reqCtx, r, uuid, u); err != nil {
+			writeError(w, http.StatusBadRequest, ash.CodeInvalidRequest, "failed to read request body")
+			return
 		}
+		reqCtx = httptrace.WithClientTrace(reqCtx, upstreamTrace)
+		debugf("gateway", "[gateway] routing request: method=%s path=%q target=%s timeout=%s", r.Method, r.URL.Path, u.String(), config.RequestTimeout)
 		proxy.ServeHTTP(w, r.WithContext(reqCtx))
 	})
 
 	// Create HTTP server with timeouts
 	srv := http.Server{
 		Addr:              config.ListenAddr,
-		Handler:           mux,
+		Handler:           handler,
 		ReadTimeout:       config.ReadTimeout,
 		WriteTimeout:      config.WriteTimeout,
 		IdleTimeout:       config.IdleTimeout,
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 
-	// Start server in a goroutine
+	adminSrv := http.Server{
+		Addr:              config.AdminAddr,
+		Handler:           adminMux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	// Start servers in goroutines
 	go func() {
 		log.Printf("[gateway] listening on %s", config.ListenAddr)
 		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Fatalf("server error: %v", err)
+			logging.Fatalf("server error: %v", err)
+		}
+	}()
+	go func() {
+		log.Printf("[gateway] admin endpoints listening on %s", config.AdminAddr)
+		if err := adminSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Fatalf("admin server error: %v", err)
 		}
 	}()
 
@@ -360,14 +522,15 @@ func main() {
 	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// Shutdown the server
+	// Shutdown the servers
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		logging.Fatalf("Server forced to shutdown: %v", err)
 	}
+	_ = adminSrv.Shutdown(ctx)
 
 	// Close Redis connection
 	if err := rdb.Close(); err != nil {
-		log.Printf("Error closing Redis connection: %v", err)
+		logging.Errorf("Error closing Redis connection: %v", err)
 	}
 
 	log.Println("Server exited properly")
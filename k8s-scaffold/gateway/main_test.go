@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/rl-sandbox/k8s-pkg/store"
+)
+
+// withConfig installs c as the package config for the duration of the test
+func withConfig(t *testing.T, c *Config) {
+	old := config
+	config = c
+	t.Cleanup(func() { config = old })
+}
+
+// withDomains installs the routing domains for the duration of the test, the first being the default
+func withDomains(t *testing.T, ds ...*routingDomain) {
+	oldDomains, oldDefault := domains, defaultDomain
+	domains, defaultDomain = ds, ds[0]
+	t.Cleanup(func() { domains, defaultDomain = oldDomains, oldDefault })
+}
+
+// newTestRedis starts an in-memory Redis and returns it with a connected client
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return mr, client
+}
+
+func TestLookupTargetPort(t *testing.T) {
+	mr, client := newTestRedis(t)
+
+	mr.HSet("sandbox:no-port", "host", "sb-1.ash.svc.cluster.local")
+	mr.HSet("sandbox:with-port", "host", "sb-2.ash.svc.cluster.local", "port", "9000")
+	mr.HSet("tool:no-port", "host", "tool-1.ash.svc.cluster.local")
+
+	sandboxes := &routingDomain{Name: "default", Scheme: "http", BasePath: "/mcp", routes: store.New(client, "sandbox:")}
+	tools := &routingDomain{Name: "tool", Scheme: "http", DefaultPort: 8080, routes: store.New(client, "tool:")}
+
+	tests := []struct {
+		name   string
+		domain *routingDomain
+		uuid   string
+		want   string
+	}{
+		{"record port wins", sandboxes, "with-port", "http://sb-2.ash.svc.cluster.local:9000/mcp"},
+		{"store default without domain default", sandboxes, "no-port", "http://sb-1.ash.svc.cluster.local:3000/mcp"},
+		{"domain default_port", tools, "no-port", "http://tool-1.ash.svc.cluster.local:8080"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _, err := lookupTarget(context.Background(), tt.domain, tt.uuid)
+			if err != nil {
+				t.Fatalf("lookupTarget: %v", err)
+			}
+			if u.String() != tt.want {
+				t.Errorf("lookupTarget = %s, want %s", u, tt.want)
+			}
+		})
+	}
+}
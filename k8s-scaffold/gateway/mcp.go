@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/rl-sandbox/k8s-pkg/ash"
+)
+
+// mcpInitializeMaxBytes bounds how much of a header-less request is buffered to detect initialize
+const mcpInitializeMaxBytes = 1 << 20
+
+// isMCPInitialize reports whether r is a JSON-RPC "initialize" call, alone or in a batch.
+// The body is buffered and left readable for the proxy.
+func isMCPInitialize(r *http.Request) bool {
+	if r.Method != http.MethodPost || !strings.Contains(r.Header.Get("Content-Type"), "json") {
+		return false
+	}
+	if err := bufferRequestBody(r, mcpInitializeMaxBytes); err != nil || r.GetBody == nil {
+		return false
+	}
+	body, err := r.GetBody()
+	if err != nil {
+		return false
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return false
+	}
+
+	type call struct {
+		Method string `json:"method"`
+	}
+	var single call
+	if err := json.Unmarshal(data, &single); err == nil {
+		return single.Method == "initialize"
+	}
+	var batch []call
+	if err := json.Unmarshal(data, &batch); err == nil {
+		for _, c := range batch {
+			if c.Method == "initialize" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// provisionLimiter bounds concurrent auto-provisions so a client looping on
+// initialize cannot spawn sandboxes faster than they are set up
+type provisionLimiter struct {
+	mu       sync.Mutex
+	inflight int
+	clients  map[string]bool
+}
+
+var mcpProvisions = &provisionLimiter{clients: map[string]bool{}}
+
+// acquire reserves a slot for client, failing if the client already has a
+// provision running or max provisions are running in total
+func (l *provisionLimiter) acquire(client string, max int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.clients[client] || l.inflight >= max {
+		return false
+	}
+	l.clients[client] = true
+	l.inflight++
+	return true
+}
+
+func (l *provisionLimiter) release(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.clients, client)
+	l.inflight--
+}
+
+// autoProvisionMCP spawns a sandbox for an MCP client that connected without a session
+// header and binds the request to it. The session header is set on both the forwarded
+// request and the response so the client can route its follow-up calls. On failure the
+// error response is written and "" is returned. Each client may provision one
+// session at a time, and MCP_AUTO_PROVISION_MAX bounds them across clients.
+func autoProvisionMCP(w http.ResponseWriter, r *http.Request) string {
+	client := clientIP(r)
+	if !mcpProvisions.acquire(client, config.MCPAutoProvisionMax) {
+		w.Header().Set("Retry-After", "5")
+		writeError(w, http.StatusTooManyRequests, ash.CodeRateLimited, "too many sessions being provisioned")
+		return ""
+	}
+	defer mcpProvisions.release(client)
+
+	ctx, cancel := context.WithTimeout(r.Context(), config.SessionSpawnTimeout)
+	defer cancel()
+
+	spawned, ok := provisionSession(ctx, w, []byte(config.MCPSpawnTemplate))
+	if !ok {
+		return ""
+	}
+
+	logger("mcp").Info("auto-provisioned session", "uuid", spawned.UUID, "name", spawned.Name, "client", client)
+	r.Header.Set(config.SessionHeader, spawned.UUID)
+	w.Header().Set(config.SessionHeader, spawned.UUID)
+	return spawned.UUID
+}
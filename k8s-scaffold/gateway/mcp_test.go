@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestProvisionLimiter(t *testing.T) {
+	l := &provisionLimiter{clients: map[string]bool{}}
+
+	if !l.acquire("10.0.0.1", 2) {
+		t.Fatal("first provision of a client was refused")
+	}
+	if l.acquire("10.0.0.1", 2) {
+		t.Error("second concurrent provision of the same client was allowed")
+	}
+	if !l.acquire("10.0.0.2", 2) {
+		t.Fatal("provision of another client under the cap was refused")
+	}
+	if l.acquire("10.0.0.3", 2) {
+		t.Error("provision over the gateway-wide cap was allowed")
+	}
+
+	l.release("10.0.0.1")
+	if !l.acquire("10.0.0.3", 2) {
+		t.Error("provision after a release was refused")
+	}
+	if l.inflight != 2 || len(l.clients) != 2 {
+		t.Errorf("inflight = %d with %d clients, want 2 and 2", l.inflight, len(l.clients))
+	}
+}
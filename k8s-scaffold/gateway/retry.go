@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/rl-sandbox/k8s-pkg/backoff"
+	"github.com/rl-sandbox/k8s-pkg/logging"
+)
+
+// bufferRequestBody makes small request bodies replayable by reading them into memory
+// and setting GetBody. Bodies larger than maxBytes are streamed unchanged and never retried.
+func bufferRequestBody(r *http.Request, maxBytes int64) error {
+	if r.Body == nil || r.Body == http.NoBody || maxBytes <= 0 {
+		return nil
+	}
+	if r.ContentLength > maxBytes {
+		return nil
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(buf)) > maxBytes {
+		// Too large to buffer: stitch the consumed prefix back onto the stream
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+		return nil
+	}
+
+	_ = r.Body.Close()
+	r.ContentLength = int64(len(buf))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf)), nil
+	}
+	r.Body, _ = r.GetBody()
+	return nil
+}
+
+// retryTransport retries requests that failed before any of them reached the
+// upstream, as happens while a sandbox pod is restarting. A request whose
+// headers were written is never retried: the upstream may already have run a
+// non-idempotent JSON-RPC call even if the connection broke before it answered.
+type retryTransport struct {
+	base   http.RoundTripper
+	policy backoff.Policy
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var resp *http.Response
+	var lastErr error
+	attempt := 0
+	err := backoff.Retry(req.Context(), t.policy, func(ctx context.Context) error {
+		attempt++
+		next := req
+		if attempt > 1 {
+			// A consumed body cannot be replayed, so the previous failure stands
+			if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+				return backoff.Permanent(lastErr)
+			}
+			next = req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return backoff.Permanent(lastErr)
+				}
+				next.Body = body
+			}
+			logging.Warnf("[proxy][retry] attempt=%d url=%s after error: %v", attempt, req.URL.String(), lastErr)
+		}
+
+		var retryable bool
+		resp, retryable, lastErr = t.roundTrip(next)
+		if lastErr != nil && !retryable {
+			return backoff.Permanent(lastErr)
+		}
+		return lastErr
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// roundTrip sends req once and reports whether it failed before reaching the upstream:
+// on a dial failure, or before the request headers were written
+func (t *retryTransport) roundTrip(req *http.Request) (*http.Response, bool, error) {
+	var wrote atomic.Bool
+	trace := &httptrace.ClientTrace{
+		WroteHeaders: func() { wrote.Store(true) },
+	}
+	resp, err := t.base.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err == nil {
+		return resp, false, nil
+	}
+	return resp, isRetryableError(err) || !wrote.Load(), err
+}
+
+// isRetryableError reports whether err proves the request never left the gateway.
+// Resets and EOFs do not: they may arrive after the upstream ran the request.
+func isRetryableError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/rl-sandbox/k8s-pkg/backoff"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	// Errors that prove the request never reached the upstream
+	for _, err := range []error{
+		&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("no route to host")},
+		&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)},
+		fmt.Errorf("proxy: %w", syscall.ECONNREFUSED),
+	} {
+		if !isRetryableError(err) {
+			t.Errorf("isRetryableError(%v) = false, want true", err)
+		}
+	}
+
+	// Errors the upstream may have caused after running the request
+	for _, err := range []error{
+		&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)},
+		io.EOF,
+		io.ErrUnexpectedEOF,
+		&net.OpError{Op: "write", Net: "tcp", Err: syscall.EPIPE},
+		errors.New("boom"),
+	} {
+		if isRetryableError(err) {
+			t.Errorf("isRetryableError(%v) = true, want false", err)
+		}
+	}
+}
+
+// roundTripFunc stubs the upstream transport
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestRetryTransportOnlyRetriesUnsentRequests(t *testing.T) {
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	tests := []struct {
+		name      string
+		wrote     bool // Whether the failing attempt wrote its headers
+		err       error
+		wantCalls int
+	}{
+		{"reset before headers were written", false, reset, 3},
+		{"reset after headers were written", true, reset, 1},
+		{"refused", false, syscall.ECONNREFUSED, 3},
+		{"eof after headers were written", true, io.EOF, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			rt := &retryTransport{
+				base: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+					calls++
+					if trace := httptrace.ContextClientTrace(r.Context()); tt.wrote && trace != nil {
+						trace.WroteHeaders()
+					}
+					return nil, tt.err
+				}),
+				policy: backoff.Policy{MaxAttempts: 3},
+			}
+			req := httptest.NewRequest(http.MethodPost, "http://sandbox/mcp", nil)
+			if _, err := rt.RoundTrip(req); !errors.Is(err, tt.err) {
+				t.Fatalf("RoundTrip error = %v, want %v", err, tt.err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("upstream called %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rl-sandbox/k8s-pkg/ash"
+	"github.com/rl-sandbox/k8s-pkg/backoff"
+	"github.com/rl-sandbox/k8s-pkg/logging"
+)
+
+// spawnResponse mirrors the subset of the control-plane SpawnResp we rely on
+type spawnResponse struct {
+	Name   string `json:"name"`
+	UUID   string `json:"uuid"`
+	Status string `json:"status"`
+	Host   string `json:"host"`
+	Ports  []int  `json:"ports"`
+	Error  string `json:"error"`
+	Code   string `json:"code"`
+}
+
+// sessionResponse is returned to clients of POST /sessions
+type sessionResponse struct {
+	SessionID string `json:"session_id"`
+	Header    string `json:"header"`
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+}
+
+var spawnClient = &http.Client{}
+
+// spawnSandbox asks the control-plane to create a sandbox from the given spawn payload
+func spawnSandbox(ctx context.Context, body []byte) (*spawnResponse, int, error) {
+	endpoint := strings.TrimRight(config.ControlPlaneURL, "/") + "/spawn"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, fmt.Errorf("build spawn request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := spawnClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("spawn request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var out spawnResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("decode spawn response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &out, resp.StatusCode, fmt.Errorf("control-plane returned %d: %s", resp.StatusCode, out.Error)
+	}
+	return &out, resp.StatusCode, nil
+}
+
+// deprovisionSandbox asks the control-plane to delete a sandbox the gateway
+// spawned but cannot hand to a client. It runs on a detached context because
+// the client's request has usually already timed out.
+func deprovisionSandbox(uuid string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	endpoint := strings.TrimRight(config.ControlPlaneURL, "/") + "/deprovision/" + url.PathEscape(uuid)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint, nil)
+	if err != nil {
+		logging.Errorf("[sessions] deprovision %s failed: %v", uuid, err)
+		return
+	}
+	resp, err := spawnClient.Do(req)
+	if err != nil {
+		logging.Errorf("[sessions] deprovision %s failed: %v", uuid, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		logging.Errorf("[sessions] deprovision %s failed: control-plane returned %d", uuid, resp.StatusCode)
+		return
+	}
+	log.Printf("[sessions] deprovisioned sandbox %s that never became ready", uuid)
+}
+
+// waitSandboxReady polls the routed upstream until it accepts TCP connections
+func waitSandboxReady(ctx context.Context, uuid string) error {
+	policy := backoff.Policy{
+		InitialBackoff: 250 * time.Millisecond,
+		MaxBackoff:     2 * time.Second,
+		Jitter:         0.2,
+	}
+	err := backoff.Retry(ctx, policy, func(ctx context.Context) error {
+		lookupCtx, cancel := context.WithTimeout(ctx, config.RedisLookupTimeout)
+		u, _, err := lookupTarget(lookupCtx, defaultDomain, uuid)
+		cancel()
+		if err != nil {
+			return err
+		}
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", u.Host)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+	if err != nil {
+		return fmt.Errorf("sandbox %s not ready: %w", uuid, err)
+	}
+	return nil
+}
+
+// provisionSession spawns a sandbox from the given spawn payload and waits until it
+// accepts connections. On failure it writes the error response and returns false;
+// a sandbox that was spawned but never became ready is deprovisioned.
+func provisionSession(ctx context.Context, w http.ResponseWriter, body []byte) (*spawnResponse, bool) {
+	spawned, code, err := spawnSandbox(ctx, body)
+	if err != nil {
+		logging.Errorf("[sessions] spawn failed: %v", err)
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			writeError(w, http.StatusGatewayTimeout, ash.CodeUpstreamTimeout, "spawn timeout")
+		case spawned != nil && code >= 400 && code < 500:
+			errCode := spawned.Code
+			if errCode == "" {
+				errCode = ash.CodeInvalidRequest
+			}
+			writeError(w, code, errCode, "spawn rejected: "+spawned.Error)
+		default:
+			writeError(w, http.StatusBadGateway, ash.CodeSpawnFailed, "spawn failed")
+		}
+		return nil, false
+	}
+
+	if !strings.EqualFold(spawned.Status, "ready") {
+		if err := waitSandboxReady(ctx, spawned.UUID); err != nil {
+			logging.Warnf("[sessions] %v", err)
+			deprovisionSandbox(spawned.UUID)
+			writeError(w, http.StatusGatewayTimeout, ash.CodeSandboxNotReady, "sandbox not ready")
+			return nil, false
+		}
+	}
+	return spawned, true
+}
+
+// handleCreateSession spawns a sandbox via the control-plane and returns its session header value
+func handleCreateSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, ash.CodeMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ash.CodeInvalidRequest, "failed to read request body")
+		return
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		body = []byte(fmt.Sprintf(`{"image":%q}`, config.DefaultSandboxImage))
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), config.SessionSpawnTimeout)
+	defer cancel()
+
+	spawned, ok := provisionSession(ctx, w, body)
+	if !ok {
+		return
+	}
+
+	logger("sessions").Info("session created", "uuid", spawned.UUID, "name", spawned.Name)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(config.SessionHeader, spawned.UUID)
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(sessionResponse{
+		SessionID: spawned.UUID,
+		Header:    config.SessionHeader,
+		Name:      spawned.Name,
+		Status:    "ready",
+	})
+}
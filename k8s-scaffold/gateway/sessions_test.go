@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rl-sandbox/k8s-pkg/store"
+)
+
+// A sandbox that never becomes reachable must not outlive the failed request
+func TestProvisionSessionDeprovisionsUnreadySandbox(t *testing.T) {
+	var mu sync.Mutex
+	var deleted []string
+	cp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/spawn":
+			w.Write([]byte(`{"uuid":"sb-1","name":"sandbox-1","status":"pending"}`))
+		case r.Method == http.MethodDelete:
+			mu.Lock()
+			deleted = append(deleted, r.URL.Path)
+			mu.Unlock()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer cp.Close()
+
+	_, client := newTestRedis(t)
+	withConfig(t, &Config{ControlPlaneURL: cp.URL, RedisLookupTimeout: time.Second})
+	withDomains(t, &routingDomain{Name: "default", Scheme: "http", routes: store.New(client, "sandbox:")})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	rec := httptest.NewRecorder()
+	if _, ok := provisionSession(ctx, rec, []byte(`{"image":"python"}`)); ok {
+		t.Fatal("provisionSession succeeded for a sandbox without a route")
+	}
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusGatewayTimeout)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(deleted) != 1 || deleted[0] != "/deprovision/sb-1" {
+		t.Errorf("deprovision calls = %v, want [/deprovision/sb-1]", deleted)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Transformation rules rewrite proxied requests and responses without code changes.
+// They are loaded from TRANSFORM_RULES_FILE, a YAML list such as:
+//
+//	- name: tag-sandbox
+//	  match: {path_prefix: /mcp, methods: [POST]}
+//	  request:
+//	    set_headers: {X-Sandbox-Upstream: "${upstream_host}"}
+//	  response:
+//	    set_headers: {X-Sandbox-ID: "${uuid}"}
+//	    remove_headers: [Server]
+//	    body_replace: [{pattern: "10\\.\\d+\\.\\d+\\.\\d+", replace: "[internal]"}]
+//
+// Header values expand ${uuid}, ${upstream}, ${upstream_host}, ${client_ip}, ${method} and ${path}.
+// All matching rules apply in file order.
+
+type transformMatch struct {
+	PathPrefix string            `yaml:"path_prefix"`
+	Methods    []string          `yaml:"methods"`
+	Headers    map[string]string `yaml:"headers"` // Header -> regexp the value must match
+	headerRes  map[string]*regexp.Regexp
+}
+
+type bodyReplace struct {
+	Pattern string `yaml:"pattern"`
+	Replace string `yaml:"replace"`
+	re      *regexp.Regexp
+}
+
+type transformActions struct {
+	SetHeaders    map[string]string `yaml:"set_headers"`
+	RemoveHeaders []string          `yaml:"remove_headers"`
+	BodyReplace   []bodyReplace     `yaml:"body_replace"`
+}
+
+type transformRule struct {
+	Name     string           `yaml:"name"`
+	Match    transformMatch   `yaml:"match"`
+	Request  transformActions `yaml:"request"`
+	Response transformActions `yaml:"response"`
+}
+
+// transformVars holds the values header templates may reference
+type transformVars map[string]string
+
+var (
+	transformRules []*transformRule
+	transformKey   = &struct{}{} // context key for the rules matched by a request
+)
+
+// loadTransformRules reads and compiles the rules file, if configured
+func loadTransformRules(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read transform rules: %w", err)
+	}
+	var rules []*transformRule
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("parse transform rules %s: %w", path, err)
+	}
+	for i, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = "rule-" + strconv.Itoa(i)
+		}
+		rule.Match.headerRes = map[string]*regexp.Regexp{}
+		for h, pattern := range rule.Match.Headers {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("transform rule %s: header %s: %w", rule.Name, h, err)
+			}
+			rule.Match.headerRes[h] = re
+		}
+		for _, actions := range []*transformActions{&rule.Request, &rule.Response} {
+			for j := range actions.BodyReplace {
+				re, err := regexp.Compile(actions.BodyReplace[j].Pattern)
+				if err != nil {
+					return fmt.Errorf("transform rule %s: body pattern: %w", rule.Name, err)
+				}
+				actions.BodyReplace[j].re = re
+			}
+		}
+	}
+	transformRules = rules
+	return nil
+}
+
+func (m *transformMatch) matches(r *http.Request) bool {
+	if m.PathPrefix != "" && !strings.HasPrefix(r.URL.Path, m.PathPrefix) {
+		return false
+	}
+	if len(m.Methods) > 0 {
+		found := false
+		for _, method := range m.Methods {
+			found = found || strings.EqualFold(method, r.Method)
+		}
+		if !found {
+			return false
+		}
+	}
+	for h, re := range m.headerRes {
+		if !re.MatchString(r.Header.Get(h)) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchTransforms returns the rules applying to r with their template variables
+func matchTransforms(r *http.Request, uuid string, target *url.URL) ([]*transformRule, transformVars) {
+	var matched []*transformRule
+	for _, rule := range transformRules {
+		if rule.Match.matches(r) {
+			matched = append(matched, rule)
+		}
+	}
+	vars := transformVars{
+		"uuid":          uuid,
+		"upstream":      target.String(),
+		"upstream_host": target.Host,
+		"client_ip":     clientIP(r),
+		"method":        r.Method,
+		"path":          r.URL.Path,
+	}
+	return matched, vars
+}
+
+func (a *transformActions) applyHeaders(h http.Header, vars transformVars) {
+	for _, name := range a.RemoveHeaders {
+		h.Del(name)
+	}
+	for name, value := range a.SetHeaders {
+		h.Set(name, os.Expand(value, func(k string) string { return vars[k] }))
+	}
+}
+
+// rewriteBody applies body replacements to bodies up to maxBytes. Larger, encoded
+// or streaming bodies are passed through unchanged.
+func rewriteBody(body io.ReadCloser, header http.Header, actions []*transformActions, maxBytes int64) (io.ReadCloser, int64, bool, error) {
+	n := 0
+	for _, a := range actions {
+		n += len(a.BodyReplace)
+	}
+	if n == 0 || body == nil || body == http.NoBody || header.Get("Content-Encoding") != "" ||
+		strings.HasPrefix(header.Get("Content-Type"), "text/event-stream") {
+		return body, 0, false, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxBytes+1))
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if int64(len(data)) > maxBytes {
+		// Too large: stitch the consumed prefix back onto the stream untouched
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), body), body}, 0, false, nil
+	}
+	_ = body.Close()
+	for _, a := range actions {
+		for _, br := range a.BodyReplace {
+			data = br.re.ReplaceAll(data, []byte(br.Replace))
+		}
+	}
+	return io.NopCloser(bytes.NewReader(data)), int64(len(data)), true, nil
+}
+
+// transformRequest applies the request side of the matched rules and remembers
+// them for the response in the returned context
+func transformRequest(ctx context.Context, r *http.Request, uuid string, target *url.URL) (context.Context, error) {
+	rules, vars := matchTransforms(r, uuid, target)
+	if len(rules) == 0 {
+		return ctx, nil
+	}
+
+	var actions []*transformActions
+	for _, rule := range rules {
+		rule.Request.applyHeaders(r.Header, vars)
+		actions = append(actions, &rule.Request)
+		debugf("transform", "[transform] request rule=%s uuid=%s", rule.Name, uuid)
+	}
+	body, size, rewritten, err := rewriteBody(r.Body, r.Header, actions, config.TransformMaxBodyBytes)
+	if err != nil {
+		return ctx, err
+	}
+	if rewritten {
+		data, _ := io.ReadAll(body)
+		r.ContentLength = size
+		r.Header.Set("Content-Length", strconv.FormatInt(size, 10))
+		r.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}
+		r.Body, _ = r.GetBody()
+	} else {
+		r.Body = body
+	}
+
+	return context.WithValue(ctx, transformKey, &matchedTransforms{rules: rules, vars: vars}), nil
+}
+
+type matchedTransforms struct {
+	rules []*transformRule
+	vars  transformVars
+}
+
+// transformResponse applies the response side of the rules matched by the request
+func transformResponse(resp *http.Response) error {
+	matched, _ := resp.Request.Context().Value(transformKey).(*matchedTransforms)
+	if matched == nil {
+		return nil
+	}
+
+	var actions []*transformActions
+	for _, rule := range matched.rules {
+		rule.Response.applyHeaders(resp.Header, matched.vars)
+		actions = append(actions, &rule.Response)
+	}
+	body, size, rewritten, err := rewriteBody(resp.Body, resp.Header, actions, config.TransformMaxBodyBytes)
+	if err != nil {
+		return err
+	}
+	resp.Body = body
+	if rewritten {
+		resp.ContentLength = size
+		resp.Header.Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// rewrite runs rewriteBody over body and returns the resulting text
+func rewrite(t *testing.T, body string, header http.Header, actions *transformActions, maxBytes int64) (string, bool) {
+	t.Helper()
+	out, size, rewritten, err := rewriteBody(io.NopCloser(strings.NewReader(body)), header, []*transformActions{actions}, maxBytes)
+	if err != nil {
+		t.Fatalf("rewriteBody: %v", err)
+	}
+	got, _ := io.ReadAll(out)
+	if rewritten && size != int64(len(got)) {
+		t.Errorf("size = %d, want %d", size, len(got))
+	}
+	return string(got), rewritten
+}
+
+func TestRewriteBody(t *testing.T) {
+	redactIPs := &transformActions{BodyReplace: []bodyReplace{
+		{Replace: "[internal]", re: regexp.MustCompile(`10\.\d+\.\d+\.\d+`)},
+	}}
+
+	if got, ok := rewrite(t, `{"host":"10.0.3.7"}`, http.Header{}, redactIPs, 1024); !ok || got != `{"host":"[internal]"}` {
+		t.Errorf("plain JSON = %q, rewritten=%t", got, ok)
+	}
+	if got, ok := rewrite(t, `10.0.3.7`, http.Header{}, redactIPs, 8); !ok || got != `[internal]` {
+		t.Errorf("body exactly at the limit = %q, rewritten=%t", got, ok)
+	}
+	if _, ok := rewrite(t, `{"host":"10.0.3.7"}`, http.Header{}, &transformActions{}, 1024); ok {
+		t.Error("body rewritten without any replacements")
+	}
+}
+
+// Bodies the gateway cannot safely rewrite must pass through byte for byte
+func TestRewriteBodyPassThrough(t *testing.T) {
+	redactIPs := &transformActions{BodyReplace: []bodyReplace{
+		{Replace: "[internal]", re: regexp.MustCompile(`10\.\d+\.\d+\.\d+`)},
+	}}
+	cases := map[string]struct {
+		body     string
+		header   http.Header
+		maxBytes int64
+	}{
+		"compressed":   {`10.0.3.7`, http.Header{"Content-Encoding": {"gzip"}}, 1024},
+		"event stream": {`data: 10.0.3.7`, http.Header{"Content-Type": {"text/event-stream"}}, 1024},
+		"over limit":   {`host 10.0.3.7 and more`, http.Header{}, 8},
+	}
+	for name, c := range cases {
+		if got, ok := rewrite(t, c.body, c.header, redactIPs, c.maxBytes); ok || got != c.body {
+			t.Errorf("%s: got %q, rewritten=%t, want the body unchanged", name, got, ok)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// poolStats tracks upstream connection pool usage for the /metrics endpoint
+type poolStats struct {
+	dials       atomic.Int64 // Total dial attempts
+	dialErrors  atomic.Int64 // Failed dial attempts
+	openConns   atomic.Int64 // Currently open upstream connections
+	newConns    atomic.Int64 // Requests served on a freshly dialed connection
+	reusedConns atomic.Int64 // Requests served on a pooled connection
+	idleReused  atomic.Int64 // Reused connections that were sitting idle in the pool
+}
+
+var upstreamStats poolStats
+
+// countingConn decrements the open connection gauge exactly once on Close
+type countingConn struct {
+	net.Conn
+	once sync.Once
+}
+
+func (c *countingConn) Close() error {
+	c.once.Do(func() { upstreamStats.openConns.Add(-1) })
+	return c.Conn.Close()
+}
+
+// upstreamTrace records whether each proxied request got a new or pooled connection
+var upstreamTrace = &httptrace.ClientTrace{
+	GotConn: func(info httptrace.GotConnInfo) {
+		if info.Reused {
+			upstreamStats.reusedConns.Add(1)
+			if info.WasIdle {
+				upstreamStats.idleReused.Add(1)
+			}
+			return
+		}
+		upstreamStats.newConns.Add(1)
+	},
+}
+
+// loadTLSConfig builds the upstream TLS config from the configured CA file and flags
+func loadTLSConfig(cfg *Config) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		InsecureSkipVerify: cfg.UpstreamTLSInsecure,
+	}
+	if cfg.UpstreamTLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.UpstreamTLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read upstream CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.UpstreamTLSCAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	return tlsCfg, nil
+}
+
+// newUpstreamTransport builds the reverse proxy transport from configuration
+func newUpstreamTransport(cfg *Config) (*http.Transport, error) {
+	tlsCfg, err := loadTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   cfg.UpstreamDialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	if cfg.UpstreamDNSCacheTTL > 0 {
+		upstreamDNS = newDNSCache(cfg.UpstreamDNSCacheTTL)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		upstreamStats.dials.Add(1)
+		conn, err := dialUpstream(ctx, dialer, network, addr)
+		if err != nil {
+			upstreamStats.dialErrors.Add(1)
+			return nil, err
+		}
+		upstreamStats.openConns.Add(1)
+		return &countingConn{Conn: conn}, nil
+	}
+	transport.MaxIdleConns = cfg.UpstreamMaxIdleConns
+	transport.MaxIdleConnsPerHost = cfg.UpstreamMaxIdleConnsPerHost
+	transport.MaxConnsPerHost = cfg.UpstreamMaxConnsPerHost
+	transport.IdleConnTimeout = cfg.UpstreamIdleConnTimeout
+	transport.TLSHandshakeTimeout = 10 * time.Second
+	transport.TLSClientConfig = tlsCfg
+	transport.ExpectContinueTimeout = 1 * time.Second
+	transport.ResponseHeaderTimeout = cfg.UpstreamResponseHeaderTimeout // Allow upstream to process before responding
+	return transport, nil
+}
+
+// handleMetrics exposes upstream and Redis pool stats in Prometheus text format
+func handleMetrics(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	metric := func(name, kind, help string, value int64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+	}
+
+	metric("gateway_upstream_dials_total", "counter", "Upstream dial attempts.", upstreamStats.dials.Load())
+	metric("gateway_upstream_dial_errors_total", "counter", "Failed upstream dial attempts.", upstreamStats.dialErrors.Load())
+	metric("gateway_upstream_open_connections", "gauge", "Currently open upstream connections.", upstreamStats.openConns.Load())
+	metric("gateway_upstream_new_connections_total", "counter", "Requests served on a newly dialed connection.", upstreamStats.newConns.Load())
+	metric("gateway_upstream_reused_connections_total", "counter", "Requests served on a pooled connection.", upstreamStats.reusedConns.Load())
+	metric("gateway_upstream_idle_reused_connections_total", "counter", "Pooled connections reused after sitting idle.", upstreamStats.idleReused.Load())
+
+	if upstreamDNS != nil {
+		metric("gateway_upstream_dns_cache_hits_total", "counter", "Upstream host lookups served from the DNS cache.", upstreamDNS.hits.Load())
+		metric("gateway_upstream_dns_cache_misses_total", "counter", "Upstream host lookups that queried DNS.", upstreamDNS.misses.Load())
+		metric("gateway_upstream_dns_cache_refreshes_total", "counter", "Cached upstream hosts re-resolved after failed dials.", upstreamDNS.refresh.Load())
+	}
+
+	rs := rdb.PoolStats()
+	metric("gateway_redis_pool_hits_total", "counter", "Redis pool connection hits.", int64(rs.Hits))
+	metric("gateway_redis_pool_misses_total", "counter", "Redis pool connection misses.", int64(rs.Misses))
+	metric("gateway_redis_pool_timeouts_total", "counter", "Redis pool wait timeouts.", int64(rs.Timeouts))
+	metric("gateway_redis_pool_total_connections", "gauge", "Redis connections in the pool.", int64(rs.TotalConns))
+	metric("gateway_redis_pool_idle_connections", "gauge", "Idle Redis connections in the pool.", int64(rs.IdleConns))
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rl-sandbox/k8s-pkg/ash"
+	"github.com/rl-sandbox/k8s-pkg/logging"
+)
+
+// handleTunnel upgrades the client connection to a raw TCP stream to a sandbox port.
+// Clients send either CONNECT or GET with "Connection: Upgrade" and "Upgrade: tcp".
+func handleTunnel(w http.ResponseWriter, r *http.Request) {
+	uuid := r.PathValue("uuid")
+	port, err := strconv.Atoi(r.PathValue("port"))
+	if err != nil || port <= 0 || port > 65535 {
+		writeError(w, http.StatusBadRequest, ash.CodeInvalidRequest, "invalid port")
+		return
+	}
+
+	isUpgrade := strings.EqualFold(r.Header.Get("Upgrade"), "tcp") &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+	if r.Method != http.MethodConnect && !isUpgrade {
+		writeError(w, http.StatusUpgradeRequired, ash.CodeInvalidRequest, "expected CONNECT or Upgrade: tcp")
+		return
+	}
+
+	domain, ok := selectDomain(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, ash.CodeInvalidRequest, "unknown routing domain")
+		return
+	}
+
+	lookupCtx, lookupCancel := context.WithTimeout(r.Context(), config.RedisLookupTimeout)
+	defer lookupCancel()
+	u, _, err := lookupTarget(lookupCtx, domain, uuid)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			writeError(w, http.StatusNotFound, ash.CodeNotFound, "route not found")
+			return
+		}
+		logging.Errorf("[tunnel] lookup error: %v", err)
+		writeError(w, http.StatusBadGateway, ash.CodeRouteLookupError, "route lookup error")
+		return
+	}
+
+	if !tunnelPortAllowed(config.TunnelAllowedPorts, port, u) {
+		writeError(w, http.StatusForbidden, ash.CodeForbidden, "port not allowed")
+		return
+	}
+
+	addr := net.JoinHostPort(u.Hostname(), strconv.Itoa(port))
+	upstream, err := dialUpstream(r.Context(), &net.Dialer{Timeout: config.UpstreamDialTimeout}, "tcp", addr)
+	if err != nil {
+		logging.Errorf("[tunnel] dial %s failed: %v", addr, err)
+		writeError(w, http.StatusBadGateway, ash.CodeUpstreamError, "bad gateway")
+		return
+	}
+	defer upstream.Close()
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, ash.CodeInternal, "tunneling not supported")
+		return
+	}
+	client, buf, err := hj.Hijack()
+	if err != nil {
+		logging.Errorf("[tunnel] hijack failed: %v", err)
+		return
+	}
+	defer client.Close()
+
+	// The server's read/write deadlines would otherwise cut long-lived tunnels
+	_ = client.SetDeadline(time.Time{})
+
+	if r.Method == http.MethodConnect {
+		_, err = client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+	} else {
+		_, err = client.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: tcp\r\nConnection: Upgrade\r\n\r\n"))
+	}
+	if err != nil {
+		return
+	}
+
+	log.Printf("[tunnel] opened uuid=%s addr=%s client=%s", uuid, addr, clientIP(r))
+	start := time.Now()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		// Drain bytes the server already buffered before the hijack
+		_, _ = io.Copy(upstream, buf.Reader)
+		closeWrite(upstream)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(client, upstream)
+		closeWrite(client)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+
+	log.Printf("[tunnel] closed uuid=%s addr=%s duration=%s", uuid, addr, time.Since(start))
+}
+
+// tunnelPortAllowed reports whether port may be tunneled to on the sandbox at u.
+// With no allowed ports configured only the sandbox's own service port is reachable.
+func tunnelPortAllowed(allowed []int, port int, u *url.URL) bool {
+	if len(allowed) > 0 {
+		return slices.Contains(allowed, port)
+	}
+	return u.Port() == strconv.Itoa(port)
+}
+
+// closeWrite half-closes TCP connections so the peer sees EOF
+func closeWrite(c net.Conn) {
+	if tc, ok := c.(*net.TCPConn); ok {
+		_ = tc.CloseWrite()
+		return
+	}
+	_ = c.Close()
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestTunnelPortAllowed(t *testing.T) {
+	sandbox := &url.URL{Scheme: "http", Host: "sb-1.ash.svc.cluster.local:8080"}
+
+	// Without TUNNEL_ALLOWED_PORTS only the service port is reachable
+	if !tunnelPortAllowed(nil, 8080, sandbox) {
+		t.Error("service port denied without an allow list")
+	}
+	if tunnelPortAllowed(nil, 22, sandbox) {
+		t.Error("port 22 allowed without an allow list")
+	}
+
+	// An allow list replaces the service port rather than adding to it
+	allowed := []int{22, 5432}
+	for port, want := range map[int]bool{22: true, 5432: true, 6379: false, 8080: false} {
+		if got := tunnelPortAllowed(allowed, port, sandbox); got != want {
+			t.Errorf("tunnelPortAllowed(%v, %d) = %t, want %t", allowed, port, got, want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Package ash holds the structured error type returned by every Ash service,
+// so clients can branch on error codes regardless of which component failed.
+package ash
+
+// Error codes shared by the gateway and control-plane
+const (
+	CodeInvalidRequest   = "INVALID_REQUEST"
+	CodeMethodNotAllowed = "METHOD_NOT_ALLOWED"
+	CodeForbidden        = "FORBIDDEN"
+	CodeNotFound         = "NOT_FOUND"
+	CodeInternal         = "INTERNAL_ERROR"
+	CodeSandboxNotReady  = "SANDBOX_NOT_READY"
+	CodeRateLimited      = "RATE_LIMITED"
+
+	// Gateway
+	CodeRouteLookupError = "ROUTE_LOOKUP_ERROR"
+	CodeUpstreamError    = "UPSTREAM_ERROR"
+	CodeUpstreamTimeout  = "UPSTREAM_TIMEOUT"
+	CodeSpawnFailed      = "SPAWN_FAILED"
+
+	// Control-plane
+	CodeKubernetesError  = "KUBERNETES_ERROR"
+	CodeRedisError       = "REDIS_ERROR"
+	CodeImageRejected    = "IMAGE_REJECTED"
+	CodeImageScanFailed  = "IMAGE_SCAN_FAILED"
+	CodeImagePullFailed  = "IMAGE_PULL_FAILED"
+	CodeShardUnavailable = "SHARD_UNAVAILABLE"
+)
+
+// retryableCodes lists codes where repeating the same request may succeed
+var retryableCodes = map[string]bool{
+	CodeSandboxNotReady:  true,
+	CodeRateLimited:      true,
+	CodeRouteLookupError: true,
+	CodeUpstreamError:    true,
+	CodeUpstreamTimeout:  true,
+	CodeSpawnFailed:      true,
+	CodeKubernetesError:  true,
+	CodeRedisError:       true,
+	CodeImageScanFailed:  true,
+	CodeShardUnavailable: true,
+}
+
+// Retryable reports whether repeating a request that failed with code may succeed
+func Retryable(code string) bool {
+	return retryableCodes[code]
+}
+
+// Error is the structured error body of every Ash API error response
+type Error struct {
+	Code      string `json:"code"`
+	Message   string `json:"error"`
+	Retryable bool   `json:"retryable"`
+	Component string `json:"component"`
+
+	FailureStage string `json:"failure_stage,omitempty"` // Spawn step that failed, control-plane only
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// NewError builds an error raised by component, deriving the retryable flag from the code
+func NewError(component, code, message string) *Error {
+	return &Error{
+		Code:      code,
+		Message:   message,
+		Retryable: Retryable(code),
+		Component: component,
+	}
+}
+
+// AtStage records the spawn step an error happened in
+func (e *Error) AtStage(stage string) *Error {
+	e.FailureStage = stage
+	return e
+}
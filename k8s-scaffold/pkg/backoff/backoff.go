@@ -0,0 +1,101 @@
+// Package backoff retries operations with exponential backoff and jitter
+package backoff
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Policy controls exponential backoff between attempts
+type Policy struct {
+	InitialBackoff time.Duration // Delay after the first failed attempt
+	MaxBackoff     time.Duration // Upper bound for a single delay
+	Multiplier     float64       // Backoff growth factor, defaults to 2
+	Jitter         float64       // Random extra delay as a fraction of the backoff, e.g. 0.5
+	MaxElapsed     time.Duration // Stop retrying after this much total time, 0 = no limit
+	MaxAttempts    int           // Stop after this many attempts, 0 = no limit
+}
+
+// permanentError stops Retry immediately
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so Retry returns it without further attempts
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// next returns the backoff that follows d, capped at MaxBackoff
+func (p Policy) next(d time.Duration) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	d = time.Duration(float64(d) * multiplier)
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// withJitter adds a random delay of up to Jitter*d to d
+func (p Policy) withJitter(d time.Duration) time.Duration {
+	if p.Jitter <= 0 || d <= 0 {
+		return d
+	}
+	return d + time.Duration(rand.Int63n(int64(float64(d)*p.Jitter)+1))
+}
+
+// Retry calls fn until it succeeds, returns a Permanent error, the policy is
+// exhausted, or ctx is done. It returns the last error from fn.
+func Retry(ctx context.Context, policy Policy, fn func(ctx context.Context) error) error {
+	var deadline time.Time
+	if policy.MaxElapsed > 0 {
+		deadline = time.Now().Add(policy.MaxElapsed)
+	}
+
+	backoff := policy.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		var perm *permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return err
+		}
+
+		sleep := policy.withJitter(backoff)
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return err
+			}
+			if sleep > remaining {
+				sleep = remaining
+			}
+		}
+
+		timer := time.NewTimer(sleep)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		backoff = policy.next(backoff)
+	}
+}
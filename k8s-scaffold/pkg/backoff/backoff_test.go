@@ -0,0 +1,99 @@
+package backoff
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPolicyNext(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		from   time.Duration
+		want   time.Duration
+	}{
+		{"doubles by default", Policy{}, time.Second, 2 * time.Second},
+		{"custom multiplier", Policy{Multiplier: 3}, time.Second, 3 * time.Second},
+		{"capped at max", Policy{MaxBackoff: 5 * time.Second}, 4 * time.Second, 5 * time.Second},
+		{"below cap", Policy{MaxBackoff: 5 * time.Second}, 2 * time.Second, 4 * time.Second},
+		{"stays at cap", Policy{MaxBackoff: 5 * time.Second}, 5 * time.Second, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.next(tt.from); got != tt.want {
+				t.Errorf("next(%v) = %v, want %v", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyJitterBounds(t *testing.T) {
+	p := Policy{Jitter: 0.5}
+	base := 100 * time.Millisecond
+	for i := 0; i < 1000; i++ {
+		if d := p.withJitter(base); d < base || d > base+base/2 {
+			t.Fatalf("withJitter(%v) = %v, want within [%v, %v]", base, d, base, base+base/2)
+		}
+	}
+	if d := (Policy{}).withJitter(base); d != base {
+		t.Errorf("withJitter without jitter = %v, want %v", d, base)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	errFail := errors.New("fail")
+	fast := Policy{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	calls := 0
+	err := Retry(context.Background(), Policy{InitialBackoff: time.Millisecond, MaxAttempts: 3}, func(context.Context) error {
+		calls++
+		return errFail
+	})
+	if !errors.Is(err, errFail) || calls != 3 {
+		t.Errorf("MaxAttempts: err = %v after %d calls, want %v after 3", err, calls, errFail)
+	}
+
+	calls = 0
+	err = Retry(context.Background(), fast, func(context.Context) error {
+		calls++
+		return Permanent(errFail)
+	})
+	if err != errFail || calls != 1 {
+		t.Errorf("Permanent: err = %v after %d calls, want the unwrapped error after 1", err, calls)
+	}
+
+	calls = 0
+	err = Retry(context.Background(), fast, func(context.Context) error {
+		if calls++; calls < 3 {
+			return errFail
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("eventual success: err = %v after %d calls, want nil after 3", err, calls)
+	}
+}
+
+func TestRetryStopsWhenContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	errFail := errors.New("fail")
+
+	calls := 0
+	start := time.Now()
+	err := Retry(ctx, Policy{InitialBackoff: time.Hour}, func(context.Context) error {
+		calls++
+		cancel()
+		return errFail
+	})
+	if !errors.Is(err, errFail) {
+		t.Errorf("err = %v, want the last error from fn", err)
+	}
+	if calls != 1 {
+		t.Errorf("fn called %d times, want 1", calls)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Retry took %v after cancellation", elapsed)
+	}
+}
@@ -0,0 +1,97 @@
+// Package chaos holds the fault injection rules shared by the gateway and
+// control-plane. Rules are stored as a JSON list in Redis so every replica of a
+// service injects the same faults.
+package chaos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	AdminPath       = "/admin/chaos"     // Admin API path for managing rules
+	Header          = "X-Chaos-Injected" // Set on responses replaced by an injected status
+	RefreshInterval = 2 * time.Second    // How often replicas reload rules from Redis
+)
+
+// Rule injects faults into a share of the matching requests
+type Rule struct {
+	PathPrefix string   `json:"path_prefix"` // Empty matches every path
+	Methods    []string `json:"methods"`     // Empty matches every method
+	Percent    float64  `json:"percent"`     // Share of matching requests affected, 0-100
+	LatencyMs  int      `json:"latency_ms"`  // Delay added before the request is handled
+	Status     int      `json:"status"`      // Respond with this status instead of handling, 0 = handle
+	Drop       bool     `json:"drop"`        // Close the connection without any response
+}
+
+// Matches reports whether the rule applies to req
+func (r *Rule) Matches(req *http.Request) bool {
+	if r.PathPrefix != "" && !strings.HasPrefix(req.URL.Path, r.PathPrefix) {
+		return false
+	}
+	if len(r.Methods) == 0 {
+		return true
+	}
+	for _, m := range r.Methods {
+		if strings.EqualFold(m, req.Method) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate rejects rules with out-of-range values
+func Validate(rules []Rule) error {
+	for _, rule := range rules {
+		switch {
+		case rule.Percent < 0 || rule.Percent > 100:
+			return errors.New("percent must be between 0 and 100")
+		case rule.LatencyMs < 0:
+			return errors.New("latency_ms must not be negative")
+		case rule.Status != 0 && (rule.Status < 400 || rule.Status > 599):
+			return errors.New("status must be a 4xx or 5xx code")
+		}
+	}
+	return nil
+}
+
+// Pick returns the first rule that matches req and fires, or nil
+func Pick(rules []Rule, req *http.Request) *Rule {
+	for i := range rules {
+		if rules[i].Matches(req) && rand.Float64()*100 < rules[i].Percent {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// Load reads the rules stored at key, an empty list if there are none
+func Load(ctx context.Context, rdb *redis.Client, key string) ([]Rule, error) {
+	rules := []Rule{}
+	data, err := rdb.Get(ctx, key).Bytes()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &rules); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// Store replaces the rules stored at key
+func Store(ctx context.Context, rdb *redis.Client, key string, rules []Rule) error {
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	return rdb.Set(ctx, key, data, 0).Err()
+}
@@ -0,0 +1,72 @@
+package chaos
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr bool
+	}{
+		{"empty rule", Rule{}, false},
+		{"full rule", Rule{PathPrefix: "/mcp", Methods: []string{"POST"}, Percent: 50, LatencyMs: 200, Status: 503}, false},
+		{"drop", Rule{Percent: 100, Drop: true}, false},
+		{"negative percent", Rule{Percent: -1}, true},
+		{"percent over 100", Rule{Percent: 100.5}, true},
+		{"negative latency", Rule{Percent: 10, LatencyMs: -5}, true},
+		{"success status", Rule{Percent: 10, Status: 200}, true},
+		{"status out of range", Rule{Percent: 10, Status: 600}, true},
+		{"client error status", Rule{Percent: 10, Status: 429}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate([]Rule{{}, tt.rule})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate(%+v) error = %v, wantErr %t", tt.rule, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   Rule
+		method string
+		path   string
+		want   bool
+	}{
+		{"match all", Rule{}, http.MethodGet, "/anything", true},
+		{"path prefix", Rule{PathPrefix: "/mcp"}, http.MethodPost, "/mcp/tools", true},
+		{"other path", Rule{PathPrefix: "/mcp"}, http.MethodPost, "/sessions", false},
+		{"method case insensitive", Rule{Methods: []string{"post"}}, http.MethodPost, "/", true},
+		{"other method", Rule{Methods: []string{"GET", "PUT"}}, http.MethodPost, "/", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if got := tt.rule.Matches(req); got != tt.want {
+				t.Errorf("Matches(%s %s) = %t, want %t", tt.method, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPick(t *testing.T) {
+	rules := []Rule{
+		{PathPrefix: "/never", Percent: 100},
+		{PathPrefix: "/mcp", Percent: 0, Status: 500},
+		{PathPrefix: "/mcp", Percent: 100, Status: 503},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	if rule := Pick(rules, req); rule == nil || rule.Status != 503 {
+		t.Fatalf("Pick = %+v, want the 503 rule", rule)
+	}
+	if rule := Pick(rules, httptest.NewRequest(http.MethodGet, "/healthz", nil)); rule != nil {
+		t.Fatalf("Pick = %+v, want nil", rule)
+	}
+}
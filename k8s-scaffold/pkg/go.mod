@@ -0,0 +1,15 @@
+module github.com/rl-sandbox/k8s-pkg
+
+go 1.24.3
+
+require (
+	github.com/alicebob/miniredis/v2 v2.37.0
+	github.com/go-redis/redis/v8 v8.11.5
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+)
@@ -0,0 +1,114 @@
+// Package logging sets up the leveled, redacting slog handler shared by the Ash services
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rl-sandbox/k8s-pkg/settings"
+)
+
+// Setup installs a leveled slog handler as the process default, tagged with service.
+// LOG_LEVEL is debug, info, warn or error (DEBUG=true implies debug), LOG_FORMAT is
+// console or json, and LOG_SAMPLE_EVERY=N keeps only every Nth debug/info record.
+// log.Printf output is logged at info; use Errorf and Warnf for higher levels.
+// It reports whether JSON output was selected.
+func Setup(service string) bool {
+	level := slog.LevelInfo
+	if settings.String("DEBUG", "") == "true" {
+		level = slog.LevelDebug
+	}
+	switch strings.ToLower(settings.String("LOG_LEVEL", "")) {
+	case "debug":
+		level = slog.LevelDebug
+	case "warn", "warning":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	case "info":
+		level = slog.LevelInfo
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	jsonFormat := strings.EqualFold(settings.String("LOG_FORMAT", "console"), "json")
+	if jsonFormat {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+	handler = &redactingHandler{Handler: handler}
+	if every := settings.Int("LOG_SAMPLE_EVERY", 1); every > 1 {
+		handler = &samplingHandler{Handler: handler, every: uint64(every), counter: new(atomic.Uint64)}
+	}
+
+	handler = handler.WithAttrs([]slog.Attr{slog.String("service", service)})
+	slog.SetDefault(slog.New(handler))
+	// Route the log package through the same redaction and sampling as slog records
+	log.SetFlags(0)
+	log.SetOutput(&stdlibWriter{handler: handler})
+	return jsonFormat
+}
+
+// Fatalf logs the reason the process cannot continue and exits with status 1.
+// Unlike log.Fatalf, the reason is printed whatever LOG_LEVEL says.
+func Fatalf(format string, args ...any) {
+	slog.Error(fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+// Errorf logs a formatted message at error level
+func Errorf(format string, args ...any) {
+	slog.Error(fmt.Sprintf(format, args...))
+}
+
+// Warnf logs a formatted message at warn level
+func Warnf(format string, args ...any) {
+	slog.Warn(fmt.Sprintf(format, args...))
+}
+
+// stdlibWriter forwards log package output to handler at info level. Those
+// lines carry no level of their own, so anything that must survive
+// LOG_LEVEL=warn is logged through Errorf, Warnf or slog instead.
+type stdlibWriter struct {
+	handler slog.Handler
+}
+
+func (w *stdlibWriter) Write(p []byte) (int, error) {
+	if !w.handler.Enabled(context.Background(), slog.LevelInfo) {
+		return len(p), nil
+	}
+	r := slog.NewRecord(time.Now(), slog.LevelInfo, strings.TrimSuffix(string(p), "\n"), 0)
+	if err := w.handler.Handle(context.Background(), r); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// samplingHandler drops all but every Nth record below warn level
+type samplingHandler struct {
+	slog.Handler
+	every   uint64
+	counter *atomic.Uint64
+}
+
+func (h *samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelWarn && h.counter.Add(1)%h.every != 0 {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{Handler: h.Handler.WithAttrs(attrs), every: h.every, counter: h.counter}
+}
+
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{Handler: h.Handler.WithGroup(name), every: h.every, counter: h.counter}
+}
@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRedactingHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		msg    string
+		attrs  []any
+		secret string
+	}{
+		{"authorization header", "upstream sent Authorization: Bearer abc.def", nil, "abc.def"},
+		{"bearer in text", "retrying with bearer s3cr3t-token", nil, "s3cr3t-token"},
+		{"key value pair", "spawn env API_KEY=hunter2 ready", nil, "hunter2"},
+		{"sensitive attr key", "spawned", []any{"heartbeat_token", "tok-123"}, "tok-123"},
+		{"env attr", "spawned", []any{"env", "FOO=bar"}, "FOO=bar"},
+		{"string attr value", "request", []any{"header", "Authorization=Basic dXNlcjpwYXNz"}, "dXNlcjpwYXNz"},
+		{"nested group", "request", []any{slog.Group("auth", "password", "pw-1")}, "pw-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := slog.New(&redactingHandler{Handler: slog.NewTextHandler(&buf, nil)})
+			l.Info(tt.msg, tt.attrs...)
+
+			out := buf.String()
+			if strings.Contains(out, tt.secret) {
+				t.Errorf("output leaks %q: %s", tt.secret, out)
+			}
+			if !strings.Contains(out, redactedValue) {
+				t.Errorf("output has no %s marker: %s", redactedValue, out)
+			}
+		})
+	}
+}
+
+func TestRedactingHandlerWithAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(&redactingHandler{Handler: slog.NewTextHandler(&buf, nil)}).With("token", "abc")
+	l.Info("hello", "uuid", "sb-1")
+
+	out := buf.String()
+	if strings.Contains(out, "abc") || !strings.Contains(out, "uuid=sb-1") {
+		t.Errorf("output = %s, want the token masked and the uuid kept", out)
+	}
+}
+
+// countingHandler counts the records that reach it by level
+type countingHandler struct {
+	slog.Handler
+	counts map[slog.Level]int
+}
+
+func (h *countingHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *countingHandler) Handle(_ context.Context, r slog.Record) error {
+	h.counts[r.Level]++
+	return nil
+}
+
+func TestSamplingHandler(t *testing.T) {
+	sink := &countingHandler{counts: map[slog.Level]int{}}
+	l := slog.New(&samplingHandler{Handler: sink, every: 3, counter: new(atomic.Uint64)})
+
+	for i := 0; i < 9; i++ {
+		l.Info("tick")
+	}
+	for i := 0; i < 4; i++ {
+		l.Warn("slow")
+		l.Error("boom")
+	}
+
+	if got := sink.counts[slog.LevelInfo]; got != 3 {
+		t.Errorf("info records kept = %d, want every 3rd of 9", got)
+	}
+	if got := sink.counts[slog.LevelWarn] + sink.counts[slog.LevelError]; got != 8 {
+		t.Errorf("warn and error records kept = %d, want all 8", got)
+	}
+}
+
+func TestStdlibWriterLogsAtInfo(t *testing.T) {
+	var buf bytes.Buffer
+	w := &stdlibWriter{handler: slog.NewTextHandler(&buf, nil)}
+	if _, err := w.Write([]byte("Failed to list deployments\n")); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "level=INFO") {
+		t.Errorf("output = %s, want an info record", out)
+	}
+
+	buf.Reset()
+	w = &stdlibWriter{handler: slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn})}
+	if _, err := w.Write([]byte("Sandbox created\n")); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("output = %s, want nothing below LOG_LEVEL", buf.String())
+	}
+}
@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redactedValue = "[REDACTED]"
+
+var (
+	// Authorization header values, including the auth scheme
+	authHeaderPattern = regexp.MustCompile(`(?i)(authorization["']?\s*[:=]\s*)("[^"]*"|(?:(?:bearer|basic)\s+)?[^\s,;"]+)`)
+	// Bearer/basic credentials outside of a header
+	authSchemePattern = regexp.MustCompile(`(?i)\b(bearer|basic)\s+([A-Za-z0-9\-._~+/]+=*)`)
+	// KEY=value or KEY: value pairs whose key looks like a credential
+	secretPairPattern = regexp.MustCompile(`(?i)([a-z0-9_\-]*(token|secret|password|passwd|api_?key|access_?key|credential)[a-z0-9_\-]*)(["']?\s*[=:]\s*)("[^"]*"|'[^']*'|[^\s,;}]+)`)
+)
+
+// sensitiveKey reports whether an attribute key names a credential or environment payload
+func sensitiveKey(key string) bool {
+	k := strings.ToLower(key)
+	for _, s := range []string{"token", "secret", "password", "passwd", "authorization", "api_key", "apikey", "credential", "env"} {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactString masks credentials embedded in free-form text
+func redactString(s string) string {
+	s = authHeaderPattern.ReplaceAllString(s, "${1}"+redactedValue)
+	s = authSchemePattern.ReplaceAllString(s, "${1} "+redactedValue)
+	return secretPairPattern.ReplaceAllString(s, "${1}${3}"+redactedValue)
+}
+
+// redactAttr masks sensitive attribute values, recursing into groups
+func redactAttr(a slog.Attr) slog.Attr {
+	if sensitiveKey(a.Key) {
+		return slog.String(a.Key, redactedValue)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redactString(a.Value.String()))
+	case slog.KindGroup:
+		attrs := a.Value.Group()
+		out := make([]any, 0, len(attrs))
+		for _, ga := range attrs {
+			out = append(out, redactAttr(ga))
+		}
+		return slog.Group(a.Key, out...)
+	}
+	return a
+}
+
+// redactingHandler masks secrets in log messages and attributes before they are written
+type redactingHandler struct {
+	slog.Handler
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, redactString(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, out)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	masked := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		masked[i] = redactAttr(a)
+	}
+	return &redactingHandler{Handler: h.Handler.WithAttrs(masked)}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{Handler: h.Handler.WithGroup(name)}
+}
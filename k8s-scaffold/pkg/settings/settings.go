@@ -0,0 +1,169 @@
+// Package settings loads service configuration from defaults, an optional YAML
+// file, the environment and -set flags, and reports where each value came from.
+//
+// Precedence, lowest to highest: defaults < config file < env < -set flags.
+// The config file is a flat YAML map using the same keys as the environment variables.
+package settings
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	configFile    = flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file (KEY: value, same keys as env vars)")
+	flagOverrides = overrides{}
+	fileValues    = map[string]string{}
+
+	sourcesMu sync.Mutex
+	sources   = map[string]string{} // config key -> file, env or flag
+)
+
+func init() {
+	flag.Var(flagOverrides, "set", "override a config key as KEY=VALUE (repeatable)")
+}
+
+// overrides collects repeated -set KEY=VALUE flags
+type overrides map[string]string
+
+func (o overrides) String() string {
+	return fmt.Sprint(map[string]string(o))
+}
+
+func (o overrides) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("expected KEY=VALUE, got %q", s)
+	}
+	o[strings.TrimSpace(k)] = v
+	return nil
+}
+
+// Load parses flags and reads the optional config file
+func Load() error {
+	flag.Parse()
+	if *configFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(*configFile)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("parse config file %s: %w", *configFile, err)
+	}
+	for k, v := range raw {
+		fileValues[k] = fmt.Sprint(v)
+	}
+	return nil
+}
+
+// Lookup returns the configured value for key, or "" if unset
+func Lookup(key string) string {
+	value, source := "", ""
+	if v, ok := flagOverrides[key]; ok {
+		value, source = v, "flag"
+	} else if v := os.Getenv(key); v != "" {
+		value, source = v, "env"
+	} else if v, ok := fileValues[key]; ok {
+		value, source = v, "file"
+	}
+
+	if source != "" {
+		sourcesMu.Lock()
+		sources[key] = source
+		sourcesMu.Unlock()
+	}
+	return value
+}
+
+// String returns the configured value for key or a default
+func String(key, def string) string {
+	if v := Lookup(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// Int returns the configured value for key as int or a default
+func Int(key string, def int) int {
+	if v := Lookup(key); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+		slog.Warn(fmt.Sprintf("Invalid integer value for %s: %s, using default %d", key, v, def))
+	}
+	return def
+}
+
+// Bool returns the configured value for key as bool or a default
+func Bool(key string, def bool) bool {
+	if v := Lookup(key); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+		slog.Warn(fmt.Sprintf("Invalid boolean value for %s: %s, using default %t", key, v, def))
+	}
+	return def
+}
+
+// Duration returns the configured value for key as a Go duration or a default
+func Duration(key string, def time.Duration) time.Duration {
+	if v := Lookup(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+		slog.Warn(fmt.Sprintf("Invalid duration value for %s: %s, using default %s", key, v, def))
+	}
+	return def
+}
+
+// IntList returns the comma-separated integers configured for key, skipping invalid entries
+func IntList(key string) []int {
+	var out []int
+	for _, part := range strings.Split(Lookup(key), ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// Effective describes a loaded config struct for /configz: every field's value,
+// the source of each key that was set, and the config file. Fields tagged
+// `secret:"true"` are masked when set.
+func Effective(config any) map[string]interface{} {
+	effective := map[string]string{}
+	v := reflect.Indirect(reflect.ValueOf(config))
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		value := fmt.Sprint(v.Field(i).Interface())
+		if field.Tag.Get("secret") == "true" && value != "" {
+			value = "[REDACTED]"
+		}
+		effective[field.Name] = value
+	}
+
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	keySources := make(map[string]string, len(sources))
+	for k, s := range sources {
+		keySources[k] = s
+	}
+	return map[string]interface{}{
+		"config":      effective,
+		"sources":     keySources,
+		"config_file": *configFile,
+	}
+}
@@ -0,0 +1,103 @@
+package settings
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withOverrides installs -set flag values for the duration of a test
+func withOverrides(t *testing.T, values map[string]string) {
+	t.Helper()
+	for k, v := range values {
+		flagOverrides[k] = v
+	}
+	t.Cleanup(func() {
+		for k := range values {
+			delete(flagOverrides, k)
+		}
+	})
+}
+
+// withConfigFile loads a YAML config file for the duration of a test
+func withConfigFile(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	prev := *configFile
+	*configFile = path
+	t.Cleanup(func() {
+		*configFile = prev
+		fileValues = map[string]string{}
+	})
+	if err := Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	withConfigFile(t, "FROM_ALL: file\nFROM_FILE_ENV: file\nFROM_FILE: file\n")
+	t.Setenv("FROM_ALL", "env")
+	t.Setenv("FROM_FILE_ENV", "env")
+	withOverrides(t, map[string]string{"FROM_ALL": "flag"})
+
+	tests := []struct {
+		key        string
+		want       string
+		wantSource string
+	}{
+		{"FROM_ALL", "flag", "flag"},
+		{"FROM_FILE_ENV", "env", "env"},
+		{"FROM_FILE", "file", "file"},
+		{"FROM_NOWHERE", "default", ""},
+	}
+	for _, tt := range tests {
+		if got := String(tt.key, "default"); got != tt.want {
+			t.Errorf("String(%s) = %q, want %q", tt.key, got, tt.want)
+		}
+		sources := Effective(&struct{}{})["sources"].(map[string]string)
+		if got := sources[tt.key]; got != tt.wantSource {
+			t.Errorf("source of %s = %q, want %q", tt.key, got, tt.wantSource)
+		}
+	}
+}
+
+func TestTypedDefaults(t *testing.T) {
+	t.Setenv("BAD_INT", "many")
+	t.Setenv("GOOD_INT", "7")
+	t.Setenv("BAD_BOOL", "maybe")
+
+	if got := Int("BAD_INT", 3); got != 3 {
+		t.Errorf("Int(BAD_INT) = %d, want the default 3", got)
+	}
+	if got := Int("GOOD_INT", 3); got != 7 {
+		t.Errorf("Int(GOOD_INT) = %d, want 7", got)
+	}
+	if got := Bool("BAD_BOOL", true); !got {
+		t.Error("Bool(BAD_BOOL) = false, want the default true")
+	}
+}
+
+func TestEffectiveRedactsSecretFields(t *testing.T) {
+	config := struct {
+		RedisPassword   string `secret:"true"`
+		RequireToken    bool
+		CredentialsName string
+		EmptySecret     string `secret:"true"`
+	}{RedisPassword: "hunter2", RequireToken: true, CredentialsName: "registry-creds"}
+
+	got := Effective(&config)["config"].(map[string]string)
+	want := map[string]string{
+		"RedisPassword":   "[REDACTED]",
+		"RequireToken":    "true",
+		"CredentialsName": "registry-creds",
+		"EmptySecret":     "",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// migrations upgrade a raw record from version N to N+1, keyed by N.
+// Each returns the fields to write back.
+var migrations = map[int]func(fields map[string]string, now time.Time) map[string]interface{}{
+	// v1 -> v2: add timestamps and the schema version field
+	1: func(fields map[string]string, now time.Time) map[string]interface{} {
+		out := map[string]interface{}{FieldSchemaVersion: 2}
+		if fields[FieldCreatedAt] == "" {
+			out[FieldCreatedAt] = formatTime(now)
+		}
+		if fields[FieldUpdatedAt] == "" {
+			out[FieldUpdatedAt] = formatTime(now)
+		}
+		return out
+	},
+}
+
+// Migrate upgrades every record under the prefix to SchemaVersion and
+// returns how many records were rewritten. Keys under the prefix that are not
+// hashes are skipped, and a record's TTL survives the rewrite.
+func (s *Store) Migrate(ctx context.Context) (int, error) {
+	migrated := 0
+	iter := s.Scan(ctx, "*")
+	for iter.Next(ctx) {
+		key := iter.Val()
+		kind, err := s.rdb.Type(ctx, key).Result()
+		if err != nil {
+			return migrated, fmt.Errorf("type %s: %w", key, err)
+		}
+		if kind != "hash" {
+			log.Printf("Migrate: skipping %s, a %s rather than a sandbox record", key, kind)
+			continue
+		}
+		fields, err := s.rdb.HGetAll(ctx, key).Result()
+		if err != nil {
+			return migrated, fmt.Errorf("read %s: %w", key, err)
+		}
+		r, err := ParseRecord(fields)
+		if err != nil {
+			continue // Not a sandbox record
+		}
+		if r.SchemaVersion >= SchemaVersion {
+			continue
+		}
+
+		update := map[string]interface{}{}
+		for v := r.SchemaVersion; v < SchemaVersion; v++ {
+			step, ok := migrations[v]
+			if !ok {
+				return migrated, fmt.Errorf("no migration from schema version %d", v)
+			}
+			for k, val := range step(fields, time.Now()) {
+				update[k] = val
+				fields[k] = fmt.Sprint(val)
+			}
+		}
+
+		ttl, err := s.rdb.PTTL(ctx, key).Result()
+		if err != nil {
+			return migrated, fmt.Errorf("ttl %s: %w", key, err)
+		}
+		if ttl == -2 {
+			continue // Expired since it was read, do not resurrect it
+		}
+		pipe := s.rdb.TxPipeline()
+		pipe.HSet(ctx, key, update)
+		if ttl > 0 {
+			pipe.PExpire(ctx, key, ttl)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return migrated, fmt.Errorf("migrate %s: %w", key, err)
+		}
+		migrated++
+	}
+	return migrated, iter.Err()
+}
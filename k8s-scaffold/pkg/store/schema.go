@@ -0,0 +1,175 @@
+// Package store owns the Redis layout of sandbox route records shared by the
+// control-plane (writer) and the gateway (reader).
+//
+// Each sandbox is a hash at <prefix><uuid> with the fields below. Records may
+// carry a TTL; readers that see traffic may extend it but never shorten it.
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// SchemaVersion is the current record layout version written by Put
+const SchemaVersion = 2
+
+// DefaultKeyPrefix is the key prefix used when none is configured
+const DefaultKeyPrefix = "sandbox:"
+
+// ExperimentKeyPrefix prefixes the per-experiment sets of sandbox UUIDs
+const ExperimentKeyPrefix = "ash:experiment:"
+
+// DefaultPort is the sandbox service port. Records without a port field parse
+// with Port 0 so readers can apply their own default, usually this one.
+const DefaultPort = 3000
+
+// Record field names
+const (
+	FieldUUID           = "uuid"
+	FieldHost           = "host"
+	FieldPort           = "port"
+	FieldStatus         = "status"
+	FieldImage          = "image"
+	FieldOwner          = "owner"
+	FieldLabels         = "labels"
+	FieldCreatedAt      = "created_at"
+	FieldUpdatedAt      = "updated_at"
+	FieldExpiresAt      = "expires_at"
+	FieldSchemaVersion  = "schema_version"
+	FieldLastHeartbeat  = "last_heartbeat"
+	FieldExperimentID   = "experiment_id"
+	FieldPod            = "pod"             // Pod that sent the latest heartbeat
+	FieldRestartedAt    = "restarted_at"    // When the sandbox was last restarted
+	FieldRestartPending = "restart_pending" // Set on restart until the gateway reports it to a client
+	FieldHeartbeatToken = "heartbeat_token" // Secret the sandbox presents with its heartbeats
+)
+
+// Sandbox status values
+const (
+	StatusStarting     = "starting"
+	StatusReady        = "ready"
+	StatusUnresponsive = "unresponsive"
+)
+
+// ErrNotFound is returned when no record exists for a UUID
+var ErrNotFound = errors.New("not found")
+
+// ErrBadToken is returned when a heartbeat does not carry the record's token
+var ErrBadToken = errors.New("heartbeat token mismatch")
+
+// Record is a decoded sandbox route record
+type Record struct {
+	UUID          string
+	Host          string
+	Port          int // Zero when the record has no port, see PortOrDefault
+	Status        string
+	Image         string
+	Owner         string
+	Labels        map[string]string
+	ExperimentID  string // Groups sandboxes for bulk operations, optional
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	ExpiresAt     time.Time // Zero when the record does not expire
+	LastHeartbeat time.Time // Zero until the sandbox sends its first heartbeat
+	Pod           string    // Pod that sent the latest heartbeat, if reported
+	RestartedAt   time.Time // Zero if the sandbox was never restarted
+	SchemaVersion int
+
+	HeartbeatToken string // Secret heartbeats must present, empty for records created without one
+}
+
+// Fields encodes the record as a Redis hash at the current schema version
+func (r *Record) Fields() map[string]interface{} {
+	labels, _ := json.Marshal(r.Labels)
+	fields := map[string]interface{}{
+		FieldUUID:          r.UUID,
+		FieldHost:          r.Host,
+		FieldStatus:        r.Status,
+		FieldImage:         r.Image,
+		FieldOwner:         r.Owner,
+		FieldLabels:        string(labels),
+		FieldExperimentID:  r.ExperimentID,
+		FieldCreatedAt:     formatTime(r.CreatedAt),
+		FieldUpdatedAt:     formatTime(r.UpdatedAt),
+		FieldExpiresAt:     formatTime(r.ExpiresAt),
+		FieldSchemaVersion: SchemaVersion,
+	}
+	if r.Port != 0 {
+		fields[FieldPort] = r.Port
+	}
+	if r.HeartbeatToken != "" {
+		fields[FieldHeartbeatToken] = r.HeartbeatToken
+	}
+	return fields
+}
+
+// PortOrDefault returns the record's port, or DefaultPort if it has none
+func (r *Record) PortOrDefault() int {
+	if r.Port == 0 {
+		return DefaultPort
+	}
+	return r.Port
+}
+
+// ParseRecord decodes a Redis hash, applying defaults for missing fields except
+// the port, which is left zero
+func ParseRecord(fields map[string]string) (*Record, error) {
+	if len(fields) == 0 || fields[FieldHost] == "" {
+		return nil, ErrNotFound
+	}
+
+	r := &Record{
+		UUID:   fields[FieldUUID],
+		Host:   fields[FieldHost],
+		Status: fields[FieldStatus],
+		Image:  fields[FieldImage],
+		Owner:  fields[FieldOwner],
+
+		ExperimentID: fields[FieldExperimentID],
+	}
+	if p := fields[FieldPort]; p != "" {
+		port, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q: %w", p, err)
+		}
+		r.Port = port
+	}
+	if l := fields[FieldLabels]; l != "" && l != "null" {
+		if err := json.Unmarshal([]byte(l), &r.Labels); err != nil {
+			return nil, fmt.Errorf("invalid labels: %w", err)
+		}
+	}
+	r.CreatedAt = parseTime(fields[FieldCreatedAt])
+	r.UpdatedAt = parseTime(fields[FieldUpdatedAt])
+	r.ExpiresAt = parseTime(fields[FieldExpiresAt])
+	r.LastHeartbeat = parseTime(fields[FieldLastHeartbeat])
+	r.Pod = fields[FieldPod]
+	r.RestartedAt = parseTime(fields[FieldRestartedAt])
+	r.HeartbeatToken = fields[FieldHeartbeatToken]
+
+	r.SchemaVersion = 1 // Records written before versioning carry no version field
+	if v := fields[FieldSchemaVersion]; v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			r.SchemaVersion = n
+		}
+	}
+	return r, nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func parseTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
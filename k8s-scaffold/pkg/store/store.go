@@ -0,0 +1,220 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Store reads and writes sandbox records under a key prefix
+type Store struct {
+	rdb    *redis.Client
+	prefix string
+}
+
+// New returns a Store using prefix, or DefaultKeyPrefix when empty
+func New(rdb *redis.Client, prefix string) *Store {
+	if prefix == "" {
+		prefix = DefaultKeyPrefix
+	}
+	return &Store{rdb: rdb, prefix: prefix}
+}
+
+// Key returns the Redis key for a sandbox UUID
+func (s *Store) Key(uuid string) string {
+	return s.prefix + uuid
+}
+
+// Prefix returns the configured key prefix
+func (s *Store) Prefix() string {
+	return s.prefix
+}
+
+// Put writes a record at the current schema version, setting a TTL when ttl > 0
+func (s *Store) Put(ctx context.Context, r *Record, ttl time.Duration) error {
+	key := s.Key(r.UUID)
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, key, r.Fields())
+	if ttl > 0 {
+		pipe.Expire(ctx, key, ttl)
+	}
+	if r.ExperimentID != "" {
+		pipe.SAdd(ctx, ExperimentKeyPrefix+r.ExperimentID, r.UUID)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Get loads the full record for a UUID
+func (s *Store) Get(ctx context.Context, uuid string) (*Record, error) {
+	fields, err := s.rdb.HGetAll(ctx, s.Key(uuid)).Result()
+	if err != nil {
+		return nil, err
+	}
+	return ParseRecord(fields)
+}
+
+// Route is the subset of a record needed to proxy a request
+type Route struct {
+	Host           string
+	Port           int
+	RestartPending bool // The sandbox restarted and no client has been told yet
+}
+
+// Route loads only the fields needed to route a request to the sandbox
+func (s *Store) Route(ctx context.Context, uuid string) (*Route, error) {
+	vals, err := s.rdb.HMGet(ctx, s.Key(uuid), FieldHost, FieldPort, FieldRestartPending).Result()
+	if err != nil {
+		return nil, fmt.Errorf("redis lookup error: %w", err)
+	}
+	fields := map[string]string{}
+	if v, ok := vals[0].(string); ok {
+		fields[FieldHost] = v
+	}
+	if v, ok := vals[1].(string); ok {
+		fields[FieldPort] = v
+	}
+	r, err := ParseRecord(fields)
+	if err != nil {
+		return nil, err
+	}
+	_, pending := vals[2].(string)
+	return &Route{Host: r.Host, Port: r.Port, RestartPending: pending}, nil
+}
+
+// Touch extends an existing TTL to ttl; records without a TTL are left untouched
+func (s *Store) Touch(ctx context.Context, uuid string, ttl time.Duration) error {
+	return s.rdb.ExpireGT(ctx, s.Key(uuid), ttl).Err()
+}
+
+// heartbeatScript applies a heartbeat to an existing record in one step so a
+// record deleted or expired meanwhile is not recreated without its TTL.
+// Returns 0 if the record is gone, -1 on a token mismatch and 1 otherwise.
+// Records without a token are rejected when ARGV[4] is '1'.
+var heartbeatScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then return 0 end
+local token = redis.call('HGET', KEYS[1], '` + FieldHeartbeatToken + `')
+if not token or token == '' then
+	if ARGV[4] == '1' then return -1 end
+elseif token ~= ARGV[3] then
+	return -1
+end
+redis.call('HSET', KEYS[1], '` + FieldLastHeartbeat + `', ARGV[1], '` + FieldUpdatedAt + `', ARGV[1])
+if redis.call('HGET', KEYS[1], '` + FieldStatus + `') == '` + StatusUnresponsive + `' then
+	redis.call('HSET', KEYS[1], '` + FieldStatus + `', '` + StatusReady + `')
+end
+if ARGV[2] ~= '' then
+	local prev = redis.call('HGET', KEYS[1], '` + FieldPod + `')
+	if prev and prev ~= '' and prev ~= ARGV[2] then
+		redis.call('HSET', KEYS[1], '` + FieldRestartedAt + `', ARGV[1], '` + FieldRestartPending + `', '1')
+	end
+	redis.call('HSET', KEYS[1], '` + FieldPod + `', ARGV[2])
+end
+return 1
+`)
+
+// Heartbeat records a liveness ping, restoring an unresponsive sandbox to ready.
+// When pod differs from the previously reporting pod the sandbox is marked restarted.
+// Records that carry a heartbeat token only accept pings presenting it; records
+// without one accept any ping unless requireToken is set.
+func (s *Store) Heartbeat(ctx context.Context, uuid, pod, token string, requireToken bool) (*Record, error) {
+	require := "0"
+	if requireToken {
+		require = "1"
+	}
+	res, err := heartbeatScript.Run(ctx, s.rdb, []string{s.Key(uuid)}, formatTime(time.Now()), pod, token, require).Int()
+	if err != nil {
+		return nil, err
+	}
+	switch res {
+	case 0:
+		return nil, ErrNotFound
+	case -1:
+		return nil, ErrBadToken
+	}
+	return s.Get(ctx, uuid)
+}
+
+// MarkRestarted records that the sandbox's pods were replaced. The reporting pod is
+// forgotten so the replacement's first heartbeat does not flag the restart again.
+func (s *Store) MarkRestarted(ctx context.Context, uuid string) error {
+	now := formatTime(time.Now())
+	pipe := s.rdb.TxPipeline()
+	pipe.HSet(ctx, s.Key(uuid),
+		FieldRestartedAt, now,
+		FieldRestartPending, "1",
+		FieldUpdatedAt, now,
+	)
+	pipe.HDel(ctx, s.Key(uuid), FieldPod)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// ClaimRestart clears a pending restart flag, reporting whether this caller cleared it.
+// Exactly one caller observes each restart even with several gateway replicas.
+func (s *Store) ClaimRestart(ctx context.Context, uuid string) (bool, error) {
+	n, err := s.rdb.HDel(ctx, s.Key(uuid), FieldRestartPending).Result()
+	return n == 1, err
+}
+
+// setIfExistsScript sets hash fields only when the hash still exists
+var setIfExistsScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then return 0 end
+redis.call('HSET', KEYS[1], unpack(ARGV))
+return 1
+`)
+
+// SetStatus updates the status of an existing record. A record deleted or
+// expired meanwhile is left gone rather than recreated without its TTL.
+func (s *Store) SetStatus(ctx context.Context, uuid, status string) error {
+	return setIfExistsScript.Run(ctx, s.rdb, []string{s.Key(uuid)},
+		FieldStatus, status,
+		FieldUpdatedAt, formatTime(time.Now()),
+	).Err()
+}
+
+// Delete removes the record for a UUID and its experiment membership
+func (s *Store) Delete(ctx context.Context, uuid string) error {
+	experiment, err := s.rdb.HGet(ctx, s.Key(uuid), FieldExperimentID).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	pipe := s.rdb.TxPipeline()
+	pipe.Del(ctx, s.Key(uuid))
+	if experiment != "" {
+		pipe.SRem(ctx, ExperimentKeyPrefix+experiment, uuid)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Experiment loads the records of an experiment's sandboxes, pruning members whose
+// records expired
+func (s *Store) Experiment(ctx context.Context, id string) ([]*Record, error) {
+	key := ExperimentKeyPrefix + id
+	uuids, err := s.rdb.SMembers(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	var records []*Record
+	for _, uuid := range uuids {
+		r, err := s.Get(ctx, uuid)
+		if errors.Is(err, ErrNotFound) {
+			s.rdb.SRem(ctx, key, uuid)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// Scan iterates keys whose UUID matches pattern (e.g. "name-*")
+func (s *Store) Scan(ctx context.Context, pattern string) *redis.ScanIterator {
+	return s.rdb.Scan(ctx, 0, s.prefix+pattern, 0).Iterator()
+}
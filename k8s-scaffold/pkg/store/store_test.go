@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newTestStore(t *testing.T) (*miniredis.Miniredis, *Store) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return mr, New(client, DefaultKeyPrefix)
+}
+
+func TestHeartbeatToken(t *testing.T) {
+	mr, s := newTestStore(t)
+	mr.HSet("sandbox:with-token", FieldHost, "sb-1.ash", FieldHeartbeatToken, "secret")
+	mr.HSet("sandbox:legacy", FieldHost, "sb-2.ash")
+	ctx := context.Background()
+
+	tests := []struct {
+		uuid         string
+		token        string
+		requireToken bool
+		wantErr      error
+	}{
+		{"with-token", "secret", true, nil},
+		{"with-token", "wrong", false, ErrBadToken},
+		{"with-token", "", false, ErrBadToken},
+		{"legacy", "anything", false, nil},
+		{"legacy", "anything", true, ErrBadToken},
+		{"legacy", "", true, ErrBadToken},
+		{"missing", "secret", true, ErrNotFound},
+	}
+	for _, tt := range tests {
+		_, err := s.Heartbeat(ctx, tt.uuid, "", tt.token, tt.requireToken)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Heartbeat(%s, token %q, require %t) error = %v, want %v", tt.uuid, tt.token, tt.requireToken, err, tt.wantErr)
+		}
+	}
+	if mr.Exists("sandbox:missing") {
+		t.Error("heartbeat recreated a missing record")
+	}
+	if mr.HGet("sandbox:legacy", FieldLastHeartbeat) == "" {
+		t.Error("accepted heartbeat was not recorded")
+	}
+}
+
+func TestHeartbeatPodChangeMarksRestart(t *testing.T) {
+	mr, s := newTestStore(t)
+	mr.HSet("sandbox:sb", FieldHost, "sb.ash", FieldHeartbeatToken, "t", FieldStatus, StatusUnresponsive)
+	ctx := context.Background()
+
+	r, err := s.Heartbeat(ctx, "sb", "pod-a", "t", true)
+	if err != nil {
+		t.Fatalf("Heartbeat: %v", err)
+	}
+	if r.Status != StatusReady {
+		t.Errorf("status = %q, want %q after a heartbeat", r.Status, StatusReady)
+	}
+	if mr.HGet("sandbox:sb", FieldRestartPending) != "" {
+		t.Error("first reporting pod flagged a restart")
+	}
+	if _, err := s.Heartbeat(ctx, "sb", "pod-b", "t", true); err != nil {
+		t.Fatalf("Heartbeat: %v", err)
+	}
+	if mr.HGet("sandbox:sb", FieldRestartPending) != "1" {
+		t.Error("new reporting pod did not flag a restart")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	mr, s := newTestStore(t)
+	mr.HSet("sandbox:v1", FieldHost, "sb-1.ash", FieldStatus, StatusReady)
+	mr.SetTTL("sandbox:v1", time.Hour)
+	mr.HSet("sandbox:current", FieldHost, "sb-2.ash", FieldSchemaVersion, fmt.Sprint(SchemaVersion))
+	if err := mr.Set("sandbox:stray", "not a record"); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := s.Migrate(context.Background())
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("migrated = %d, want 1", n)
+	}
+	if got := mr.HGet("sandbox:v1", FieldSchemaVersion); got != fmt.Sprint(SchemaVersion) {
+		t.Errorf("schema version = %q, want %d", got, SchemaVersion)
+	}
+	if mr.HGet("sandbox:v1", FieldCreatedAt) == "" {
+		t.Error("created_at was not backfilled")
+	}
+	if ttl := mr.TTL("sandbox:v1"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("ttl after migrate = %v, want the original hour", ttl)
+	}
+	if got, _ := mr.Get("sandbox:stray"); got != "not a record" {
+		t.Errorf("stray key = %q, want it untouched", got)
+	}
+}
@@ -0,0 +1,52 @@
+"""
+Heartbeat client - reports sandbox liveness to the control plane.
+
+Enabled when the control plane injects ASH_HEARTBEAT_URL. Each tick first checks
+that the local MCP server answers HTTP (catching hangs a TCP probe cannot), then
+POSTs to the heartbeat URL with the ASH_HEARTBEAT_TOKEN bearer token. The pod
+name is included so the control plane can tell when the sandbox was restarted.
+"""
+import json
+import os
+import threading
+import time
+import urllib.error
+import urllib.request
+
+
+def server_responds(url: str, timeout: float) -> bool:
+    """Return True if the local server produced any HTTP response."""
+    try:
+        urllib.request.urlopen(url, timeout=timeout)
+    except urllib.error.HTTPError:
+        return True  # An HTTP error status still means the server is responsive
+    except Exception:
+        return False
+    return True
+
+
+def run(heartbeat_url: str, interval: float, local_url: str):
+    body = json.dumps({"pod": os.environ.get("HOSTNAME", "")}).encode()
+    headers = {"Content-Type": "application/json"}
+    token = os.environ.get("ASH_HEARTBEAT_TOKEN")
+    if token:
+        headers["Authorization"] = f"Bearer {token}"
+    while True:
+        if server_responds(local_url, timeout=min(interval, 5)):
+            try:
+                req = urllib.request.Request(
+                    heartbeat_url, data=body, method="POST", headers=headers,
+                )
+                urllib.request.urlopen(req, timeout=5)
+            except Exception as e:
+                print(f"[heartbeat] failed to report: {e}", flush=True)
+        time.sleep(interval)
+
+
+def start(local_url: str = "http://127.0.0.1:3000/mcp"):
+    """Start the heartbeat thread if the control plane asked for heartbeats."""
+    heartbeat_url = os.environ.get("ASH_HEARTBEAT_URL")
+    if not heartbeat_url:
+        return
+    interval = float(os.environ.get("ASH_HEARTBEAT_INTERVAL_SEC", "10"))
+    threading.Thread(target=run, args=(heartbeat_url, interval, local_url), daemon=True).start()
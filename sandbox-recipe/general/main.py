@@ -1,6 +1,8 @@
 import os
 from fastmcp import FastMCP
 
+import heartbeat
+
 
 
 def get_config():
@@ -28,6 +30,7 @@ def get_config():
 def main():
     config = get_config()
     proxy = FastMCP.as_proxy(config, name="General Sandbox MCP Proxy")
+    heartbeat.start()
     proxy.run(transport="streamable-http", host="0.0.0.0", port=3000)
 
 if __name__ == "__main__":